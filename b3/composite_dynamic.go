@@ -0,0 +1,398 @@
+package b3
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Dynamic (schemaless) composites, like the python version's pack/unpack of dicts & lists with any old values in them.
+// The struct stuff in composite_schema.go uses tags to pick data types, here we guess them from the go type instead.
+
+const B3_COMPOSITE_DICT = 1
+const B3_COMPOSITE_LIST = 2
+
+// BytesKey is how bytes keys appear in the mixed-key map form, because []byte can't be a go map key.
+type BytesKey string
+
+// PackDict encodes a map[string]interface{}, map[int]interface{} or map[interface{}]interface{} (with
+// int, string or BytesKey keys) as the data of a CompositeDict. Items are sorted by key so output is stable.
+func PackDict(m interface{}) ([]byte, error) {
+	return DefaultRegistry.PackDict(m)
+}
+
+// UnpackDict decodes CompositeDict data into the mixed-key map form, which can hold any key type.
+// Nested dicts come back in the same form.
+func UnpackDict(buf []byte) (map[interface{}]interface{}, error) {
+	return DefaultRegistry.UnpackDict(buf)
+}
+
+// UnpackDictStr is UnpackDict for data with only string keys (e.g. from json-ish clients).
+func UnpackDictStr(buf []byte) (map[string]interface{}, error) {
+	return DefaultRegistry.UnpackDictStr(buf)
+}
+
+// UnpackDictInt is UnpackDict for data with only int keys.
+func UnpackDictInt(buf []byte) (map[int]interface{}, error) {
+	return DefaultRegistry.UnpackDictInt(buf)
+}
+
+// PackList encodes a []interface{} as the data of a CompositeList. List items have no keys.
+func PackList(list []interface{}) ([]byte, error) {
+	return DefaultRegistry.PackList(list)
+}
+
+// UnpackList decodes CompositeList data. Nested dicts come back in the mixed-key map form.
+func UnpackList(buf []byte) ([]interface{}, error) {
+	return DefaultRegistry.UnpackList(buf)
+}
+
+// PackDict is PackDict using the data types in this registry.
+func (r *Registry) PackDict(m interface{}) ([]byte, error) {
+	items, err := dictItemsFromMap(m)
+	if err != nil {
+		return nil, err
+	}
+	sortDictItems(items)
+
+	out := make([]byte, 0)
+	for _, item := range items {
+		itemBuf, err := r.packItem(item.key, item.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "dict key %v", item.key)
+		}
+		out = append(out, itemBuf...)
+	}
+	return out, nil
+}
+
+func (r *Registry) PackList(list []interface{}) ([]byte, error) {
+	out := make([]byte, 0)
+	for i, value := range list {
+		itemBuf, err := r.packItem(nil, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list index %d", i)
+		}
+		out = append(out, itemBuf...)
+	}
+	return out, nil
+}
+
+func (r *Registry) UnpackList(buf []byte) ([]interface{}, error) {
+	return r.unpackList(buf, keyModeMixed)
+}
+
+func (r *Registry) UnpackDict(buf []byte) (map[interface{}]interface{}, error) {
+	m, err := r.unpackDict(buf, keyModeMixed)
+	if err != nil {
+		return nil, err
+	}
+	return m.(map[interface{}]interface{}), nil
+}
+
+func (r *Registry) UnpackDictStr(buf []byte) (map[string]interface{}, error) {
+	m, err := r.unpackDict(buf, keyModeStr)
+	if err != nil {
+		return nil, err
+	}
+	return m.(map[string]interface{}), nil
+}
+
+func (r *Registry) UnpackDictInt(buf []byte) (map[int]interface{}, error) {
+	m, err := r.unpackDict(buf, keyModeInt)
+	if err != nil {
+		return nil, err
+	}
+	return m.(map[int]interface{}), nil
+}
+
+// ===================== Encoding ===========================
+
+type dictItem struct {
+	key   interface{}
+	value interface{}
+}
+
+func dictItemsFromMap(m interface{}) ([]dictItem, error) {
+	var items []dictItem
+	switch mm := m.(type) {
+	case map[string]interface{}:
+		for k, v := range mm {
+			items = append(items, dictItem{k, v})
+		}
+	case map[int]interface{}:
+		for k, v := range mm {
+			items = append(items, dictItem{k, v})
+		}
+	case map[interface{}]interface{}:
+		for k, v := range mm {
+			switch kk := k.(type) {
+			case int, string:
+				items = append(items, dictItem{kk, v})
+			case BytesKey:
+				items = append(items, dictItem{[]byte(kk), v})
+			default:
+				return nil, errors.Errorf("dict key type %T not supported (int, string or BytesKey)", k)
+			}
+		}
+	default:
+		return nil, errors.Errorf("PackDict input %T not a supported map type", m)
+	}
+	return items, nil
+}
+
+// ints first, then strings, then bytes. Within each, in order.
+func sortDictItems(items []dictItem) {
+	rank := func(k interface{}) int {
+		switch k.(type) {
+		case int:
+			return 0
+		case string:
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(items, func(i, j int) bool {
+		ki, kj := items[i].key, items[j].key
+		if ri, rj := rank(ki), rank(kj); ri != rj {
+			return ri < rj
+		}
+		switch a := ki.(type) {
+		case int:
+			return a < kj.(int)
+		case string:
+			return a < kj.(string)
+		}
+		return bytes.Compare(ki.([]byte), kj.([]byte)) < 0
+	})
+}
+
+// A whole item - header then data - for a dynamic value.
+func (r *Registry) packItem(key interface{}, value interface{}) ([]byte, error) {
+	dataType, valBuf, err := r.packValue(value)
+	if err != nil {
+		return nil, err
+	}
+	isNull := value == nil
+	if n, ok := value.(B3Nullable); ok {
+		isNull = n.IsNullB3()
+	}
+	hdr := ItemHeader{DataType: dataType, Key: key, IsNull: isNull, DataLen: len(valBuf)}
+	hdrBuf, err := EncodeHeader(hdr)
+	if err != nil {
+		return nil, errors.Wrap(err, "b3 item header encode fail")
+	}
+	return append(hdrBuf, valBuf...), nil
+}
+
+// Guess the data type from the go type, then encode with that type's codec.
+// ints go as UVARINT if they're >= 0 and SVARINT otherwise, same as the python guesser.
+// nil goes as a null item, of data type 0 because there's no data for the type to describe.
+func (r *Registry) packValue(value interface{}) (int, []byte, error) {
+	var dataType int
+	switch v := value.(type) {
+	case nil:
+		return 0, nil, nil
+	case B3Marshaler:
+		return v.MarshalB3()
+	case map[string]interface{}, map[int]interface{}, map[interface{}]interface{}:
+		buf, err := r.PackDict(v)
+		return B3_COMPOSITE_DICT, buf, err
+	case []interface{}:
+		buf, err := r.PackList(v)
+		return B3_COMPOSITE_LIST, buf, err
+
+	case []byte:
+		dataType = B3_BYTES
+	case string:
+		dataType = B3_UTF8
+	case bool:
+		dataType = B3_BOOL
+	case int:
+		value, dataType = intValueType(int64(v))
+	case int8:
+		value, dataType = intValueType(int64(v))
+	case int16:
+		value, dataType = intValueType(int64(v))
+	case int32:
+		value, dataType = intValueType(int64(v))
+	case int64:
+		value, dataType = intValueType(v)
+	case uint:
+		value, dataType = uint64(v), B3_UVARINT
+	case uint8:
+		value, dataType = uint64(v), B3_UVARINT
+	case uint16:
+		value, dataType = uint64(v), B3_UVARINT
+	case uint32:
+		value, dataType = uint64(v), B3_UVARINT
+	case uint64:
+		dataType = B3_UVARINT
+	case *big.Int:
+		if v == nil {
+			return 0, nil, errors.New("nil *big.Int")
+		}
+		if v.Sign() < 0 {
+			if !v.IsInt64() {
+				return 0, nil, errors.Errorf("value %s overflows SVARINT", v)
+			}
+			value, dataType = v.Int64(), B3_SVARINT
+		} else {
+			dataType = B3_UVARINT
+		}
+	case float32:
+		value, dataType = float64(v), B3_FLOAT64
+	case float64:
+		dataType = B3_FLOAT64
+	case complex64:
+		value, dataType = complex128(v), B3_COMPLEX
+	case complex128:
+		dataType = B3_COMPLEX
+	case Decimal, *Decimal:
+		dataType = B3_DECIMAL
+	case time.Time:
+		dataType = B3_STAMP64
+	default:
+		return 0, nil, errors.Errorf("can't guess b3 data type for go type %T", value)
+	}
+
+	dt, ok := r.Lookup(dataType)
+	if !ok {
+		return 0, nil, errors.Errorf("no encoder found for data type %d", dataType)
+	}
+	buf, err := dt.Encode(value)
+	return dataType, buf, err
+}
+
+// Not narrowed to int, which is 32 bits on some platforms.
+func intValueType(n int64) (interface{}, int) {
+	if n < 0 {
+		return n, B3_SVARINT
+	}
+	return uint64(n), B3_UVARINT
+}
+
+// ===================== Decoding ===========================
+
+type keyMode int
+
+const (
+	keyModeMixed keyMode = iota // map[interface{}]interface{}, bytes keys as BytesKey
+	keyModeStr                  // map[string]interface{}
+	keyModeInt                  // map[int]interface{}
+)
+
+func (r *Registry) unpackDict(buf []byte, mode keyMode) (interface{}, error) {
+	var mixed map[interface{}]interface{}
+	var strs map[string]interface{}
+	var ints map[int]interface{}
+	switch mode {
+	case keyModeStr:
+		strs = map[string]interface{}{}
+	case keyModeInt:
+		ints = map[int]interface{}{}
+	default:
+		mixed = map[interface{}]interface{}{}
+	}
+
+	err := r.unpackItems(buf, mode, func(hdr ItemHeader, value interface{}) error {
+		switch k := hdr.Key.(type) {
+		case nil:
+			return errors.New("dict item has no key")
+		case int:
+			if mode == keyModeStr {
+				return errors.Errorf("dict key %d is not a string", k)
+			}
+			if mode == keyModeInt {
+				ints[k] = value
+				return nil
+			}
+			mixed[k] = value
+		case string:
+			if mode == keyModeInt {
+				return errors.Errorf("dict key %q is not an int", k)
+			}
+			if mode == keyModeStr {
+				strs[k] = value
+				return nil
+			}
+			mixed[k] = value
+		case []byte:
+			if mode != keyModeMixed {
+				return errors.Errorf("dict key %x is bytes", k)
+			}
+			mixed[BytesKey(k)] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case keyModeStr:
+		return strs, nil
+	case keyModeInt:
+		return ints, nil
+	}
+	return mixed, nil
+}
+
+func (r *Registry) unpackList(buf []byte, mode keyMode) ([]interface{}, error) {
+	out := make([]interface{}, 0)
+	err := r.unpackItems(buf, mode, func(hdr ItemHeader, value interface{}) error {
+		if hdr.Key != nil {
+			return errors.Errorf("list item has a key (%v)", hdr.Key)
+		}
+		out = append(out, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Walk the items in buf, decoding each value and handing it to fn.
+func (r *Registry) unpackItems(buf []byte, mode keyMode, fn func(ItemHeader, interface{}) error) error {
+	index := 0
+	for index < len(buf) {
+		hdr, bytesUsed, err := DecodeHeader(buf[index:])
+		if err != nil {
+			return errors.Wrap(err, "composite decode header fail")
+		}
+		index += bytesUsed
+		if hdr.DataLen > len(buf)-index {
+			return errors.New("item data len > buffer")
+		}
+		value, err := r.unpackValue(hdr, buf[index:index+hdr.DataLen], mode)
+		if err != nil {
+			return errors.Wrapf(err, "item key %v", hdr.Key)
+		}
+		index += hdr.DataLen
+		if err := fn(hdr, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) unpackValue(hdr ItemHeader, data []byte, mode keyMode) (interface{}, error) {
+	if hdr.IsNull {
+		return nil, nil
+	}
+	switch hdr.DataType {
+	case B3_COMPOSITE_DICT:
+		return r.unpackDict(data, mode)
+	case B3_COMPOSITE_LIST:
+		return r.unpackList(data, mode)
+	}
+	dt, ok := r.Lookup(hdr.DataType)
+	if !ok {
+		return nil, errors.Errorf("no decoder found for data type %d", hdr.DataType)
+	}
+	return dt.Decode(data)
+}
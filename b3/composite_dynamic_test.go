@@ -0,0 +1,130 @@
+package b3
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictPackStr(t *testing.T) {
+	buf, err := PackDict(map[string]interface{}{"b": "foo", "a": 1, "n": nil, "z": ""})
+	assert.Nil(t, err)
+	exBuf := SBytes("67 01 61 01 01" + // "a": UVARINT 1
+		"64 01 62 03 66 6f 6f" + // "b": UTF8 "foo"
+		"a0 01 6e" + // "n": null
+		"24 01 7a") // "z": UTF8 compact zero-value
+	assert.Equal(t, exBuf, buf)
+
+	m, err := UnpackDictStr(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": "foo", "n": nil, "z": ""}, m)
+}
+
+func TestDictPackMixed(t *testing.T) {
+	src := map[interface{}]interface{}{
+		BytesKey("k"): -1,
+		"s":           map[interface{}]interface{}{1: true},
+		7:             []byte("xyz"),
+	}
+	buf, err := PackDict(src)
+	assert.Nil(t, err)
+	exBuf := SBytes("53 07 03 78 79 7a" + // 7: BYTES "xyz"
+		"61 01 73 04 55 01 01 01" + // "s": DICT {1: BOOL true}
+		"78 01 6b 01 01") // b"k": SVARINT -1
+	assert.Equal(t, exBuf, buf)
+
+	m, err := UnpackDict(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, src, m)
+
+	_, err = UnpackDictStr(buf)
+	assert.EqualError(t, err, "dict key 7 is not a string")
+	_, err = UnpackDictInt(buf)
+	assert.EqualError(t, err, "dict key \"s\" is not an int")
+}
+
+func TestDictPackInt(t *testing.T) {
+	when := time.Date(2020, 10, 21, 1, 2, 3, 0, time.UTC)
+	price, _ := ParseDecimal("19.99")
+	src := map[int]interface{}{
+		1: uint64(1 << 63),
+		2: int32(-5),
+		3: 1.5,
+		4: complex(1, 2),
+		5: when,
+		6: price,
+		7: map[int]interface{}{8: "nested"},
+		9: big.NewInt(5),
+	}
+	buf, err := PackDict(src)
+	assert.Nil(t, err)
+
+	m, err := UnpackDictInt(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1<<63), m[1])
+	assert.Equal(t, -5, m[2])
+	assert.Equal(t, 1.5, m[3])
+	assert.Equal(t, complex(1, 2), m[4])
+	assert.Equal(t, when, m[5])
+	assert.Equal(t, "19.99", m[6].(Decimal).String())
+	assert.Equal(t, map[int]interface{}{8: "nested"}, m[7])
+	assert.Equal(t, 5, m[9])
+}
+
+func TestDictMarshaler(t *testing.T) {
+	buf, err := PackDict(map[string]interface{}{"p": testMoney{5, "USD"}})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("6f 14 01 70 04 55 53 44 0a"), buf)
+
+	_, err = UnpackDict(buf) // no decoder for type 20 in the registry
+	assert.EqualError(t, err, "item key p: no decoder found for data type 20")
+}
+
+func TestDictErrors(t *testing.T) {
+	_, err := PackDict([]int{1, 2})
+	assert.EqualError(t, err, "PackDict input []int not a supported map type")
+	_, err = PackDict(map[interface{}]interface{}{1.5: 1})
+	assert.EqualError(t, err, "dict key type float64 not supported (int, string or BytesKey)")
+	_, err = PackDict(map[string]interface{}{"x": struct{}{}})
+	assert.EqualError(t, err, "dict key x: can't guess b3 data type for go type struct {}")
+
+	_, err = UnpackDict(SBytes("47 01 05")) // no key
+	assert.EqualError(t, err, "dict item has no key")
+	_, err = UnpackDict(SBytes("57 01 05 01")) // data len > buffer
+	assert.EqualError(t, err, "item data len > buffer")
+}
+
+func TestListPack(t *testing.T) {
+	src := []interface{}{1, "a", nil, []interface{}{true}, map[interface{}]interface{}{"k": -1}, []interface{}{}}
+	buf, err := PackList(src)
+	assert.Nil(t, err)
+	exBuf := SBytes("47 01 01" + // UVARINT 1
+		"44 01 61" + // UTF8 "a"
+		"80" + // null
+		"42 03 45 01 01" + // LIST [BOOL true]
+		"41 05 68 01 6b 01 01" + // DICT {"k": SVARINT -1}
+		"02") // LIST [] (compact zero-value)
+	assert.Equal(t, exBuf, buf)
+
+	list, err := UnpackList(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, src, list)
+}
+
+func TestListInDict(t *testing.T) {
+	src := map[string]interface{}{"l": []interface{}{map[string]interface{}{"x": 1.5}}}
+	buf, err := PackDict(src)
+	assert.Nil(t, err)
+	m, err := UnpackDictStr(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, src, m) // dicts inside lists come back in the same key form too
+}
+
+func TestListErrors(t *testing.T) {
+	_, err := UnpackList(SBytes("57 01 01 05")) // item with a key
+	assert.EqualError(t, err, "list item has a key (1)")
+	_, err = PackList([]interface{}{1, struct{}{}})
+	assert.EqualError(t, err, "list index 1: can't guess b3 data type for go type struct {}")
+}
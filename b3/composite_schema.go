@@ -1,20 +1,30 @@
 package b3
 
 import (
-	"fmt"
 	"reflect"
-	"sort"
-	"strconv"
 
 	"github.com/pkg/errors"
 )
 
-// fields with no b3 struct tags are ignored.
-// fields not present in the incoming data are ignored (will be 0 or whatever the incoming struct already has)
+// BufToStruct decodes CompositeDict data into the struct destStructPtr points at. Fields with no b3 struct tags
+// are ignored. Fields not present in the incoming data are left alone (they'll be 0 or whatever the struct
+// already had, see DecodeOptions.Zero).
+func BufToStruct(buf []byte, dataLen int, destStructPtr interface{}) error {
+	return DefaultRegistry.BufToStruct(buf, dataLen, destStructPtr)
+}
+
+// BufToStructOptions is BufToStruct with options, e.g. a Tracer to see what it's doing.
+func BufToStructOptions(buf []byte, dataLen int, destStructPtr interface{}, opts DecodeOptions) error {
+	return DefaultRegistry.BufToStructOptions(buf, dataLen, destStructPtr, opts)
+}
 
+// BufToStruct is BufToStruct using the data types in this registry.
+func (r *Registry) BufToStruct(buf []byte, dataLen int, destStructPtr interface{}) error {
+	return r.BufToStructOptions(buf, dataLen, destStructPtr, DecodeOptions{})
+}
 
-func BufToStruct(buf []byte, dataLen int, destStructPtr interface{}) error {
-	var ok bool
+// BufToStructOptions is BufToStructOptions using the data types in this registry.
+func (r *Registry) BufToStructOptions(buf []byte, dataLen int, destStructPtr interface{}, opts DecodeOptions) error {
 
 	// Get the struct pointer from the interface{}
 	ptr := reflect.ValueOf(destStructPtr)
@@ -29,228 +39,274 @@ func BufToStruct(buf []byte, dataLen int, destStructPtr interface{}) error {
 		return errors.New("destStructPtr must be a pointer to a struct")
 	}
 
-	// we need this to get at the b3 struct tags.
-	destStructType := reflect.TypeOf(destStructPtr).Elem()
+	if opts.Zero {
+		destStruct.Set(reflect.Zero(destStruct.Type()))
+	}
+
+	// b3gen'd types decode themselves, without the reflection. The generated code doesn't know about Strict
+	// or Tracer though, so those go the reflect way.
+	if g, ok := destStructPtr.(B3Generated); ok && !opts.Strict && opts.Tracer == nil {
+		if u, ok := g.(B3Unmarshaler); ok {
+			return u.UnmarshalB3(B3_COMPOSITE_DICT, buf)
+		}
+	}
+
+	return r.fillStruct(buf, destStruct, "", opts)
+}
+
+// path is where destStruct is in the top level struct, e.g. "Order.Customer", so errors can name the field.
+func (r *Registry) fillStruct(buf []byte, destStruct reflect.Value, path string, opts DecodeOptions) error {
+	// the b3 struct tags, already parsed and checked.
+	schema, err := r.schemaFor(destStruct.Type(), path)
+	if err != nil {
+		return err
+	}
+	seen := make([]bool, destStruct.NumField()) // for checking required fields at the end
 
 	index := 0
 	for index < len(buf) {
 		hdr, bytesUsed, err := DecodeHeader(buf[index:])
 		if err != nil {
-			return errors.Wrap(err, "fillstruct decode header fail")
+			return pathError(errors.Wrap(err, "fillstruct decode header fail"), path)
 		}
 		index += bytesUsed
-		// fmt.Println("filllstruct got header ",hdr)
+		if opts.Tracer != nil {
+			opts.Tracer.HeaderDecoded(path, hdr)
+		}
 		// [hdr]   DataType, Key(tag), IsNull, DataLen
 
-		// Policy:  key type must be int.
-		// Todo:    support for string and maybe bytes key types.
-		tag,kok := hdr.Key.(int)
-		if !kok {
-			return errors.New("only int keys supported")
+		// Policy:  key type must be int (matches b3.tag) or string (matches b3.key), so the same struct
+		//          serves both schema'd clients and ad-hoc json-like ones.
+		// Todo:    maybe bytes key types.
+		switch hdr.Key.(type) {
+		case int, string:
+		default:
+			return pathError(errors.New("only int and string keys supported"), path)
 		}
 
-		// use data type to get b3 decoder.
-		DecodeFunc,fok := B3_DECODE_FUNCS[hdr.DataType]
-		if !fok {
-			return errors.New("no decoder found for data type")
+		// Slice out the item data. Check first, because exceeding limits is a panic in go.
+		if hdr.DataLen > len(buf)-index {
+			return pathError(errors.New("item data len > buffer"), path)
 		}
+		itemData := buf[index : index+hdr.DataLen]
+		index += hdr.DataLen
 
-		// b3 decode item data to interface value.
-		// Policy:  incoming b3 nulls -> go zero-values.
-		//          otherwise "cannot use nil as type int in field value"
-		var decodedValue interface{}
-		if hdr.IsNull {
-			decodedValue,err = DecodeFunc([]byte{})		// []byte{} = empty slice,  []byte = nil slice. we want empty not nil.
-		} else {										// i dont think we can pass []byte by itself anyway, wont compile
-			decodedValue,err = DecodeFunc(buf[index:index+hdr.DataLen])
+		// with the struct we're given, find the field using struct tags b3.tag or b3.key (or b3)
+		sf, fieldFound := schema.field(hdr.Key)
+		if !fieldFound && opts.Strict {
+			return pathError(errors.Errorf("no struct field for item key %v", hdr.Key), path)
 		}
-		if err != nil {
-			return errors.Wrap(err, "b3 type decoder fail")
+		if !fieldFound { // wanted b3 tag not found in struct, ignore
+			if opts.Tracer != nil {
+				opts.Tracer.UnknownTagSkipped(path, hdr.Key)
+			}
+			continue
 		}
-		index += hdr.DataLen
-
-		// fmt.Println("key/tag number ",tag)
-		// fmt.Println("decoded value  ",decodedValue)
+		fieldPath := joinPath(path, sf.name)
 
-		// with the struct we're given, find the field using struct tags b3.tag
-
-		// Search struct for the matching field.
-		fieldFound := false
-		fieldNum := 0
-		fieldB3TypeInt := 0			// not a valid type.
-		for ; fieldNum < destStruct.NumField() ; fieldNum++ {
+		// ensure the field is settable.
+		fieldVal := destStruct.Field(sf.index)
+		if !fieldVal.CanSet() {
+			return fieldError(errors.New("struct field is not settable"), fieldPath)
+		}
+		seen[sf.index] = true
 
-			// Get struct tags b3.tag 'number'
-			tfield := destStructType.Field(fieldNum)
-			fieldB3Tag := tfield.Tag.Get("b3.tag")
-			if fieldB3Tag == "" {
-				continue								// no b3.tag struct tag, skip struct field.
+		// nullzero fields get the zero value for nulls, even pointers (which then point at a zero value).
+		if hdr.IsNull && sf.NullZero {
+			fieldVal.Set(reflect.Zero(fieldVal.Type()))
+			if fieldVal.Kind() == reflect.Ptr {
+				fieldVal.Set(reflect.New(fieldVal.Type().Elem()))
 			}
-			fieldB3TagNum,fberr := strconv.Atoi(fieldB3Tag)
-			if fberr != nil {
-				return errors.Wrap(fberr, "struct b3.tag is not a number")
-				//continue								// cant convert struct tag to int, skip struct field (?)
-			}
-			if fieldB3TagNum == tag {		// found it!
-
-				// extract the b3.type struct tag too.
-				fieldB3Type := tfield.Tag.Get("b3.type")
-				if fieldB3Type == "" {
-					return errors.New("struct b3.type is missing")
-				}
-				fieldB3TypeInt, ok = B3_TYPE_NAMES_TO_NUMBERS[fieldB3Type]
-				if !ok {
-					return errors.New("struct b3.type name not found in b3 types")
-				}
-				fieldFound = true
-				break
-			}
-		}
-		if !fieldFound {	// wanted b3 tag not found in struct, ignore
-			fmt.Println("b3 tag not found in struct tags, ignoring ",hdr.Key)
 			continue
 		}
 
-		// fieldNum now has the number of the struct field.
-		// ensure the field is valid and settable.
-		fieldVal := destStruct.Field(fieldNum)
-		if !fieldVal.IsValid() {
-			return errors.New("struct field is not valid")
+		// plain values go straight to their codec, everything else the long way.
+		if sf.scalar {
+			err = decodeScalar(fieldVal, sf.dt, hdr, itemData, fieldPath)
+		} else {
+			err = r.decodeValue(fieldVal, sf.TypeName, hdr, itemData, fieldPath, opts)
 		}
-		if !fieldVal.CanSet() {
-			return errors.New("struct field is not settable")
+		if err != nil {
+			return err // already has the full path in it
 		}
-
-		// ensure the b3 types match!
-		if hdr.DataType != fieldB3TypeInt {
-			return errors.New("struct field b3 type mismatch vs incoming data type")
+		if opts.Tracer != nil {
+			opts.Tracer.FieldSet(fieldPath, hdr)
 		}
+	}
 
-		// ---- Actually set it, woo! ----
-		refVal := reflect.ValueOf(decodedValue)
-		fieldVal.Set(refVal)
-
-		fmt.Println("struct field number ",fieldNum," name ",destStructType.Field(fieldNum).Name, " successfully set val to ",decodedValue)
-
+	for _, sf := range schema.required {
+		if !seen[sf.index] {
+			return fieldError(errors.New("required field missing"), joinPath(path, sf.name))
+		}
 	}
 	return nil
 }
 
+// StructToBuf encodes a struct as CompositeDict data, an item per b3 tagged field.
+func StructToBuf(srcStructIf interface{}) ([]byte, error) {
+	return DefaultRegistry.StructToBuf(srcStructIf)
+}
+
+// StructToBufOptions is StructToBuf with options, e.g. to use string keys.
+func StructToBufOptions(srcStructIf interface{}, opts EncodeOptions) ([]byte, error) {
+	return DefaultRegistry.StructToBufOptions(srcStructIf, opts)
+}
 
+// StructToBuf is StructToBuf using the data types in this registry.
+func (r *Registry) StructToBuf(srcStructIf interface{}) ([]byte, error) {
+	return r.StructToBufOptions(srcStructIf, EncodeOptions{})
+}
 
-func StructToBuf(srcStructIf interface{}) ([]byte, error) {
+// StructToBufOptions is StructToBufOptions using the data types in this registry.
+func (r *Registry) StructToBufOptions(srcStructIf interface{}, opts EncodeOptions) ([]byte, error) {
 	// ensure srcStruct is actually a struct
 	srcStruct := reflect.ValueOf(srcStructIf)
 	if srcStruct.Kind() != reflect.Struct {
-		return nil,errors.New("input must be a struct")
+		return nil, errors.New("input must be a struct")
 	}
-	// we need this to get at the b3 struct tags.
-	srcStructType := reflect.TypeOf(srcStructIf)
-
-	fmt.Println("ok got struct")
-	fmt.Println(srcStruct)
-	fmt.Println(srcStructType)
-
-	// go through the struct fields, encode the values and keys, make a bunch of item buffers
-	// put the item buffers into a map
-
-	itemHdrBufs := make(map[int][]byte)			// keyed by b3 tag number
-	itemValBufs := make(map[int][]byte)			// keyed by b3 tag number
-	itemKeys := make([]int, 0, 10)				// to be sorted
-
-	for fieldNum := 0 ; fieldNum < srcStruct.NumField() ; fieldNum++ {
-		// Get struct tags b3.tag 'number'
-		tfield := srcStructType.Field(fieldNum)
-		fieldB3Tag := tfield.Tag.Get("b3.tag")
-		if fieldB3Tag == "" {
-			continue								// no b3.tag struct tag, skip struct field.
-		}
-		// turn into actual number
-		fieldB3TagNum,fberr := strconv.Atoi(fieldB3Tag)
-		if fberr != nil {
-			return nil, errors.Wrap(fberr, "struct b3.tag is not a number")
-		}
-		// get b3.type name
-		fieldB3TypeName := tfield.Tag.Get("b3.type")
-		if fieldB3TypeName == "" {
-			return nil, errors.New("struct b3.type is invalid")
-		}
-		// turn into type number
-		fieldB3TypeInt, ok := B3_TYPE_NAMES_TO_NUMBERS[fieldB3TypeName]
-		if !ok {
-			return nil, errors.New("struct b3.type name not found in b3 types")
-		}
+	return r.appendTopStruct(make([]byte, 0), srcStructIf, srcStruct, opts)
+}
 
-		// so fieldB3TagNum is the key
-		// now encode the value
+// AppendStruct is StructToBuf appending to dst, see AppendUvarint64. A caller reusing one buffer can encode
+// structs without allocating, as long as v is a pointer (a struct itself only fits in an interface{} as a
+// copy) and it doesn't have maps, interface{}s or marshal methods in it.
+func AppendStruct(dst []byte, v interface{}) ([]byte, error) {
+	return DefaultRegistry.AppendStructOptions(dst, v, EncodeOptions{})
+}
 
-		// we get the value from the struct as a reflect.Value
-		fieldVal := srcStruct.Field(fieldNum)
-		fmt.Println(" field ",fieldNum," val ",fieldVal)
-		fmt.Printf(" field val   is a %T\n", fieldVal)
+// AppendStructOptions is AppendStruct with options, e.g. to use string keys.
+func AppendStructOptions(dst []byte, v interface{}, opts EncodeOptions) ([]byte, error) {
+	return DefaultRegistry.AppendStructOptions(dst, v, opts)
+}
 
-		// Turn the value into an interface value for feeding to the decoders
-		fieldIfVal := fieldVal.Interface()	// The encoder functions take interface{} and type check themselves.
-		fmt.Printf(" field ifVal is a %T\n", fieldIfVal)
+// AppendStruct is AppendStruct using the data types in this registry.
+func (r *Registry) AppendStruct(dst []byte, v interface{}) ([]byte, error) {
+	return r.AppendStructOptions(dst, v, EncodeOptions{})
+}
 
-		// Select encoder based on struct tag b3.type number.
-		// (The encoder funcs then type-assert the value to ensure it's the right concrete type.)
+// AppendStructOptions is AppendStructOptions using the data types in this registry.
+func (r *Registry) AppendStructOptions(dst []byte, v interface{}, opts EncodeOptions) ([]byte, error) {
+	srcStruct := reflect.ValueOf(v)
+	if srcStruct.Kind() == reflect.Ptr && !srcStruct.IsNil() {
+		srcStruct = srcStruct.Elem()
+	}
+	if srcStruct.Kind() != reflect.Struct {
+		return dst, errors.New("AppendStruct needs a struct or a pointer to one")
+	}
+	return r.appendTopStruct(dst, v, srcStruct, opts)
+}
 
-		// use data type to get b3 encoder.
-		EncodeFunc,fok := B3_ENCODE_FUNCS[fieldB3TypeInt]
-		if !fok {
-			return nil,errors.New("no encoder found for b3.type")
+func (r *Registry) appendTopStruct(dst []byte, v interface{}, srcStruct reflect.Value, opts EncodeOptions) ([]byte, error) {
+	// b3gen'd types encode themselves, without the reflection. The generated code only does the default options.
+	if g, ok := v.(B3Generated); ok && opts == (EncodeOptions{}) {
+		if a, ok := g.(B3Appender); ok {
+			out, err := a.AppendB3(dst)
+			if err != nil {
+				return dst, err
+			}
+			return out, nil
 		}
-
-		// Feed the value to the b3 decoders
-		valBuf,err := EncodeFunc(fieldIfVal)
-		if err != nil {
-			return nil, errors.Wrap(err, "data value encode fail")
+		if m, ok := g.(B3Marshaler); ok { // generated before there was AppendB3
+			_, buf, err := m.MarshalB3()
+			if err != nil {
+				return dst, err
+			}
+			return append(dst, buf...), nil
 		}
+	}
+	schema, err := r.schemaFor(srcStruct.Type(), "")
+	if err != nil {
+		return dst, err
+	}
+	if len(schema.fields) == 0 { // (all omitempty and empty is fine)
+		return dst, errors.New("no struct fields were successfully encoded")
+	}
+	out, err := encoder{r, opts}.appendStruct(dst, srcStruct)
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
 
-		// Make b3 item header for value
-		itmHdr := ItemHeader{DataType: fieldB3TypeInt, Key: fieldB3TagNum, IsNull: false, DataLen: len(valBuf)}
+// Errors name the field they're about, and the ones it's in get put in front as they come back up, see fieldError.
+func (e encoder) appendStruct(dst []byte, srcStruct reflect.Value) ([]byte, error) {
+	// the b3 struct tags, already parsed and checked.
+	schema, err := e.r.schemaFor(srcStruct.Type(), "")
+	if err != nil {
+		return dst, err
+	}
 
-		hdrBuf,herr := EncodeHeader(itmHdr)
-		if herr != nil {
-			return nil, errors.Wrap(err, "b3 item header encode fail")
-		}
+	// go through the struct fields in item key order (int keys first then string keys, same as PackDict),
+	// and append an item for each.
+	fields := schema.intKeyOrder
+	if e.opts.KeyStyle == StringKeys {
+		fields = schema.stringKeyOrder
+	}
+	for _, kf := range fields {
+		sf := kf.field
 
-		// Stash item hdr & value bytes in map by key/tag number
-		itemHdrBufs[fieldB3TagNum] = hdrBuf
-		itemValBufs[fieldB3TagNum] = valBuf
-		// Stash the key numbers in a slice so we can sort them
-		itemKeys = append(itemKeys, fieldB3TagNum)
+		// we get the value from the struct as a reflect.Value
+		fieldVal := srcStruct.Field(sf.index)
 
-	}
+		if (sf.OmitEmpty || e.opts.OmitEmpty) && fieldVal.IsZero() {
+			continue
+		}
+		if sf.NullZero && fieldVal.Kind() == reflect.Ptr && fieldVal.IsNil() {
+			fieldVal = reflect.Zero(fieldVal.Type().Elem()) // send the zero value instead of a null
+		}
 
-	if len(itemValBufs) == 0 {
-		return nil, errors.New("no struct fields were successfully encoded")
+		// plain values go straight to their codec, everything else the long way.
+		if sf.scalar {
+			start := len(dst)
+			dst, err = appendScalar(dst, fieldVal, sf.dt)
+			if err == nil {
+				dst, err = insertHeader(dst, start, ItemHeader{DataType: sf.dt.Number, Key: kf.key})
+			}
+		} else {
+			dst, err = e.appendItem(dst, kf.key, fieldVal, sf.TypeName)
+		}
+		if err != nil {
+			return dst, fieldError(err, sf.name) // the rest of the path goes on further up
+		}
 	}
+	return dst, nil
+}
 
-	fmt.Println("item header bufs ",itemHdrBufs)
-	fmt.Println("item val bufs    ",itemValBufs)
-
-	// sort the itemBufs keys
-	fmt.Println("keys before sort ",itemKeys)
-	sort.Ints(itemKeys)
-	fmt.Println("keys after sort  ",itemKeys)
-
-	// Then range through the keys in sorted order and just append the itemBufs into a superbuf and return that
-	outBuf := make([]byte,0) //, 0, 64)			// try and keep it on the stack for small messages (?)
-	for _,kn := range itemKeys {
-		fmt.Println("kn ",kn)
-		outBuf = append(outBuf, itemHdrBufs[kn]...)
-		fmt.Print(Hexdump(outBuf, len(outBuf)))
-		fmt.Println()
-		outBuf = append(outBuf, itemValBufs[kn]...)
-		fmt.Print(Hexdump(outBuf, len(outBuf)))
-		fmt.Println()
+// name can also be an index or map key, e.g. "[2]", which goes on with no dot.
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	if name != "" && name[0] == '[' {
+		return path + name
 	}
+	return path + "." + name
+}
+
+// An error about a struct field, e.g. "struct field Order.Lines[2].Qty: value -1 is negative, UVARINT is unsigned".
+type fieldPathError struct {
+	path string
+	err  error
+}
+
+func (e *fieldPathError) Error() string { return "struct field " + e.path + ": " + e.err.Error() }
+func (e *fieldPathError) Cause() error  { return e.err }
+func (e *fieldPathError) Unwrap() error { return e.err }
 
-	fmt.Println("Final output buf, len = ",len(outBuf))
-	fmt.Print(Hexdump(outBuf, len(outBuf)))
-	fmt.Println()
+// Top level values (see Marshal) have no path, their errors stay as they were. Decoding gives the whole path
+// at once, encoding a bit at a time as the error comes back up, so if err already names a field, fieldPath
+// goes in front of it - fieldError(fieldError(err, "Qty"), "Lines[2]") is the same as fieldError(err, "Lines[2].Qty").
+func fieldError(err error, fieldPath string) error {
+	if fieldPath == "" {
+		return err
+	}
+	if fe, ok := err.(*fieldPathError); ok {
+		return &fieldPathError{joinPath(fieldPath, fe.path), fe.err}
+	}
+	return &fieldPathError{fieldPath, err}
+}
 
-	return outBuf,nil
+// For errors about a nested struct's items as a whole rather than one field. Top level ones stay as they were.
+func pathError(err error, path string) error {
+	return fieldError(err, path)
 }
@@ -0,0 +1,404 @@
+package b3
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type basicTypesStruct struct {
+	Flag  bool       `b3.tag:"1" b3.type:"BOOL"`
+	Count int64      `b3.tag:"2" b3.type:"INT64"`
+	Ratio float64    `b3.tag:"3" b3.type:"FLOAT64"`
+	Phase complex128 `b3.tag:"4" b3.type:"COMPLEX"`
+	Name  string     `b3.tag:"5" b3.type:"UTF8"`
+}
+
+func TestStructBasicTypesRoundTrip(t *testing.T) {
+	src := basicTypesStruct{true, -123456789, 12345.6789, complex(13.37, 42.42), "foo"}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := basicTypesStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructBasicTypesZero(t *testing.T) {
+	src := basicTypesStruct{}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     bool  int64 float64 complex utf8		all compact zero-values
+	assert.Equal(t, SBytes("15 01 16 02 19 03 1d 04 14 05"), buf)
+
+	dst := basicTypesStruct{true, 5, 5.5, complex(1, 1), "bar"}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+type svarintStruct struct {
+	Delta int `b3.tag:"1" b3.type:"SVARINT"`
+	Count int `b3.tag:"2" b3.type:"UVARINT"`
+}
+
+func TestStructSvarintRoundTrip(t *testing.T) {
+	src := svarintStruct{-50, 50}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("58 01 01 63 57 02 01 32"), buf)
+
+	dst := svarintStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+type stampStruct struct {
+	When time.Time `b3.tag:"1" b3.type:"STAMP64"`
+}
+
+func TestStructStamp64RoundTrip(t *testing.T) {
+	src := stampStruct{time.Date(2020, 10, 21, 1, 2, 3, 456789, time.UTC)}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := stampStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+type decimalStruct struct {
+	Price Decimal `b3.tag:"1" b3.type:"DECIMAL"`
+}
+
+func TestStructDecimalRoundTrip(t *testing.T) {
+	src := decimalStruct{NewDecimal(big.NewInt(-1999), -2)}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := decimalStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, "-19.99", dst.Price.String())
+}
+
+type bigUvarintStruct struct {
+	Small int      `b3.tag:"1" b3.type:"UVARINT"`
+	Wide  uint64   `b3.tag:"2" b3.type:"UVARINT"`
+	Huge  *big.Int `b3.tag:"3" b3.type:"UVARINT"`
+}
+
+func TestStructBigUvarintRoundTrip(t *testing.T) {
+	huge, _ := new(big.Int).SetString("1267650600228229401496703205376", 10)
+	src := bigUvarintStruct{5, math.MaxUint64, huge}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := bigUvarintStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src.Small, dst.Small)
+	assert.Equal(t, src.Wide, dst.Wide)
+	assert.Equal(t, 0, huge.Cmp(dst.Huge))
+
+	// small values still land in the wide fields
+	src = bigUvarintStruct{5, 6, big.NewInt(7)}
+	buf, err = StructToBuf(src)
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), dst.Wide)
+	assert.Equal(t, int64(7), dst.Huge.Int64())
+}
+
+func TestStructUvarintNegative(t *testing.T) {
+	_, err := StructToBuf(svarintStruct{0, -5})
+	assert.Error(t, err)
+}
+
+func TestStructUvarintOverflow(t *testing.T) {
+	dst := svarintStruct{}
+	err := BufToStruct(SBytes("57 02 0a ff ff ff ff ff ff ff ff ff 01"), 0, &dst) // MaxUint64 into an int
+	assert.Error(t, err)
+}
+
+type nestedInner struct {
+	Count int  `b3.tag:"1" b3.type:"SVARINT"`
+	Small int8 `b3.tag:"2" b3.type:"SVARINT"`
+}
+
+type nestedMiddle struct {
+	Name  string      `b3.tag:"1" b3.type:"UTF8"`
+	Inner nestedInner `b3.tag:"2"`
+}
+
+type nestedOuter struct {
+	ID     int           `b3.tag:"1" b3.type:"UVARINT"`
+	Middle nestedMiddle  `b3.tag:"2"`
+	Ptr    *nestedMiddle `b3.tag:"3" b3.type:"DICT"`
+}
+
+func TestStructNestedBytes(t *testing.T) {
+	src := nestedMiddle{Name: "a", Inner: nestedInner{Count: -1}}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     utf8 "a"     dict len 6  svarint -1  svarint 0 (compact)
+	assert.Equal(t, SBytes("54 01 01 61 51 02 06 58 01 01 01 18 02"), buf)
+
+	dst := nestedMiddle{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructNestedRoundTrip(t *testing.T) {
+	src := nestedOuter{
+		ID:     7,
+		Middle: nestedMiddle{"mid", nestedInner{-5, 5}},
+		Ptr:    &nestedMiddle{"ptr", nestedInner{100, -100}},
+	}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := nestedOuter{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructNestedNilPointer(t *testing.T) {
+	src := nestedOuter{ID: 1}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     uvarint 1   dict: name, inner(count, small)  null dict
+	assert.Equal(t, SBytes("57 01 01 01 51 02 09 14 01 51 02 04 18 01 18 02 91 03"), buf)
+
+	dst := nestedOuter{Ptr: &nestedMiddle{Name: "old"}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+type wideInner struct {
+	Small int `b3.tag:"2" b3.type:"SVARINT"`
+}
+type wideMiddle struct {
+	Inner wideInner `b3.tag:"2"`
+}
+type wideOuter struct {
+	Middle wideMiddle `b3.tag:"2"`
+}
+
+func TestStructNestedErrorPath(t *testing.T) {
+	buf, err := StructToBuf(wideOuter{wideMiddle{wideInner{300}}})
+	assert.Nil(t, err)
+	dst := nestedOuter{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.EqualError(t, err, "struct field Middle.Inner.Small: value 300 overflows int8 field")
+
+	type statsHolder struct {
+		Stats svarintStruct `b3.tag:"1"`
+	}
+	_, err = StructToBuf(statsHolder{svarintStruct{Count: -1}})
+	assert.EqualError(t, err, "struct field Stats.Count: value -1 is negative, UVARINT is unsigned")
+}
+
+type keyedStruct struct {
+	ID    int    `b3.tag:"1" b3.key:"id" b3.type:"UVARINT"`
+	Name  string `b3.tag:"2" b3.key:"name" b3.type:"UTF8"`
+	Extra string `b3.key:"extra" b3.type:"UTF8"`
+	Count int    `b3.tag:"3" b3.type:"SVARINT"`
+}
+
+func TestStructKeysInt(t *testing.T) {
+	src := keyedStruct{5, "a", "x", -1}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     1: uvarint 5 2: utf8 "a" 3: svarint -1 "extra": utf8 "x"
+	assert.Equal(t, SBytes("57 01 01 05 54 02 01 61 58 03 01 01 64 05 65 78 74 72 61 01 78"), buf)
+
+	dst := keyedStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructKeysString(t *testing.T) {
+	src := keyedStruct{5, "a", "x", -1}
+	buf, err := StructToBufOptions(src, EncodeOptions{KeyStyle: StringKeys})
+	assert.Nil(t, err)
+	//                     3: svarint -1 "extra": utf8 "x"                "id": uvarint 5      "name": utf8 "a"
+	assert.Equal(t, SBytes("58 03 01 01 64 05 65 78 74 72 61 01 78 67 02 69 64 01 05 64 04 6e 61 6d 65 01 61"), buf)
+
+	dst := keyedStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructKeysFromDynamic(t *testing.T) {
+	// e.g. a python or json-ish client that just sends a dict
+	buf, err := PackDict(map[string]interface{}{"id": 7, "name": "bob", "unknown": true})
+	assert.Nil(t, err)
+	dst := keyedStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, keyedStruct{ID: 7, Name: "bob"}, dst)
+
+	buf, err = PackDict(map[interface{}]interface{}{BytesKey("id"): 7})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.EqualError(t, err, "only int and string keys supported")
+}
+
+func TestStructKeysNested(t *testing.T) {
+	type holder struct {
+		Inner keyedStruct `b3.tag:"1" b3.key:"inner"`
+	}
+	src := holder{keyedStruct{ID: 1, Name: "n"}}
+	buf, err := StructToBufOptions(src, EncodeOptions{KeyStyle: StringKeys})
+	assert.Nil(t, err)
+	m, err := UnpackDict(buf)
+	assert.Nil(t, err)
+	inner := m["inner"].(map[interface{}]interface{})
+	assert.Equal(t, 1, inner["id"])
+	assert.Equal(t, "n", inner["name"])
+	assert.Equal(t, 0, inner[3]) // Count only has a b3.tag
+
+	dst := holder{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+type mostlyZeroStruct struct {
+	A int     `b3:"1"`
+	B uint    `b3:"2"`
+	C float64 `b3:"3"`
+	D string  `b3:"4"`
+	E int     `b3:"5"`
+	F []int   `b3:"6"`
+}
+
+func TestStructCompactZeroValues(t *testing.T) {
+	buf, err := StructToBuf(mostlyZeroStruct{E: 1})
+	assert.Nil(t, err)
+	//                     every zero field is just its 1 byte control + key, no data len or data
+	assert.Equal(t, SBytes("18 01 17 02 19 03 14 04 58 05 01 02 12 06"), buf)
+
+	dst := mostlyZeroStruct{1, 2, 3, "4", 5, []int{6}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, mostlyZeroStruct{E: 1}, dst)
+}
+
+func TestStructOmitEmptyOption(t *testing.T) {
+	buf, err := StructToBufOptions(mostlyZeroStruct{E: 1}, EncodeOptions{OmitEmpty: true})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("58 05 01 02"), buf)
+
+	// and in nested structs
+	type holder struct {
+		Inner mostlyZeroStruct `b3:"1"`
+		Other int              `b3:"2"`
+	}
+	buf, err = StructToBufOptions(holder{Inner: mostlyZeroStruct{D: "x"}}, EncodeOptions{OmitEmpty: true})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("51 01 04 54 04 01 78"), buf)
+
+	dst := holder{Other: 5}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, holder{Inner: mostlyZeroStruct{D: "x"}, Other: 5}, dst) // omitted fields are left alone
+}
+
+type appendInner struct {
+	Code  string `b3:"1"`
+	Level uint   `b3:"2"`
+}
+
+type appendStruct struct {
+	ID    int          `b3:"1,,key=id"`
+	Name  string       `b3:"2,,key=name"`
+	OK    bool         `b3:"3,,key=ok"`
+	Ratio float64      `b3:"4,,key=ratio"`
+	Nums  []int        `b3:"5,,key=nums"`
+	Inner appendInner  `b3:"6,,key=inner"`
+	Next  *appendInner `b3:"7,,key=next"`
+	When  time.Time    `b3:"8,,key=when"`
+	Price Decimal      `b3:"9,,key=price"`
+	Blob  []byte       `b3:"10,,key=blob"`
+}
+
+func newAppendStruct() appendStruct {
+	return appendStruct{ID: -5, Name: "widget", OK: true, Ratio: 1.5, Nums: []int{1, 2, 300},
+		Inner: appendInner{"x", 3}, When: time.Unix(1600000000, 0), Price: NewDecimal(big.NewInt(1999), -2),
+		Blob: []byte{1, 2}}
+}
+
+func TestStructAppend(t *testing.T) {
+	src := newAppendStruct()
+	for _, opts := range []EncodeOptions{{}, {KeyStyle: StringKeys}, {OmitEmpty: true}} {
+		want, err := StructToBufOptions(src, opts)
+		assert.Nil(t, err)
+		buf, err := AppendStructOptions(SBytes("ff"), &src, opts) // pointer or not, same thing
+		assert.Nil(t, err)
+		assert.Equal(t, append(SBytes("ff"), want...), buf)
+		buf, err = AppendStructOptions(nil, src, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, want, buf)
+	}
+
+	buf, err := AppendStruct(SBytes("ff"), &src)
+	assert.Nil(t, err)
+	dst := appendStruct{}
+	assert.Nil(t, BufToStruct(buf[1:], len(buf)-1, &dst))
+	assert.True(t, src.When.Equal(dst.When))
+	dst.When = src.When
+	assert.Equal(t, src, dst)
+
+	// errors leave dst alone, and still say where
+	type badHolder struct {
+		OK    int           `b3:"1"`
+		Stats svarintStruct `b3:"2"`
+	}
+	buf, err = AppendStruct(SBytes("ff"), &badHolder{1, svarintStruct{Count: -1}})
+	assert.EqualError(t, err, "struct field Stats.Count: value -1 is negative, UVARINT is unsigned")
+	assert.Equal(t, SBytes("ff"), buf)
+	_, err = AppendStruct(nil, (*badHolder)(nil))
+	assert.EqualError(t, err, "AppendStruct needs a struct or a pointer to one")
+}
+
+func TestStructAppendAllocs(t *testing.T) {
+	src := newAppendStruct()
+	buf, err := AppendStruct(nil, &src) // warm up the schema cache and the buffer
+	assert.Nil(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, err = AppendStruct(buf[:0], &src)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkStructAppend(b *testing.B) {
+	src := newAppendStruct()
+	buf, _ := AppendStruct(nil, &src)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = AppendStruct(buf[:0], &src)
+	}
+}
+
+func BenchmarkStructToBuf(b *testing.B) {
+	src := newAppendStruct()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = StructToBuf(src)
+	}
+}
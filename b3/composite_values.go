@@ -0,0 +1,693 @@
+package b3
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/oddy/b3-go/internal/b3tag"
+	"github.com/pkg/errors"
+)
+
+// Encoding and decoding of single values - struct fields, and the elements of slices, arrays and maps - by reflection.
+// typeName is the b3.type tag. For slices, arrays and maps it's the type of the elements, so []string is b3.type:"UTF8".
+// path is where the value is in the top level struct, e.g. "Order.Lines[2].Qty", so decode errors can name it.
+// Errors returned from here already have the path in them (encoding's get it on the way back up, see encoder).
+// With no b3.type, the data type is inferred from the go type, see inferTypeName.
+
+// Encoding appends to the caller's buffer (see AppendStruct), so a caller that reuses one doesn't allocate.
+// Working out paths on the way down would, so encoding has no path, and each level names itself as an error
+// comes back up instead (see fieldError).
+type encoder struct {
+	r    *Registry
+	opts EncodeOptions
+}
+
+// Encode a value, appending its data bytes to dst, and returning its data type. isNull is true for nil pointers
+// and null Null* values.
+func (e encoder) appendValue(dst []byte, val reflect.Value, typeName string) (out []byte, dataType int, isNull bool, err error) {
+	if typeName == "" {
+		typeName = structTypeName(val.Type()) // before marshalField, see structTypeName
+	}
+
+	// Types that encode themselves pick their own data type (b3.type is optional for them).
+	// b3gen'd methods only do the default options though, anything else goes the reflect way.
+	if methods := methodsOf(val.Type()); e.opts == (EncodeOptions{}) && methods.any()&hasB3Generated != 0 {
+		if a, ok := marshalSource(val, methods, hasB3Appender); ok {
+			dst, err = a.(B3Appender).AppendB3(dst) // straight into dst, rather than MarshalB3's copy
+			return dst, B3_COMPOSITE_DICT, false, err
+		}
+	}
+	if e.opts == (EncodeOptions{}) || !isGenerated(val.Type()) {
+		dataType, buf, handled, err := marshalField(val, typeName)
+		if err != nil {
+			return dst, 0, false, err
+		}
+		if handled {
+			return append(dst, buf...), dataType, isNullable(val), nil
+		}
+	}
+
+	// interface{}s (e.g. the values of a map[string]interface{}) go the same as they would with PackDict.
+	if val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return dst, 0, true, nil
+		}
+		dataType, buf, err := e.r.packValue(val.Interface())
+		if err != nil {
+			return dst, 0, false, err
+		}
+		if n, ok := val.Interface().(B3Nullable); ok {
+			isNull = n.IsNullB3()
+		}
+		return append(dst, buf...), dataType, isNull, nil
+	}
+
+	// nil pointers are null items, otherwise encode what they point at. (*big.Int is a UVARINT in its own right.)
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return dst, e.r.nullDataType(val.Type().Elem(), typeName), true, nil
+		}
+		if val.Type() != bigIntPtrType {
+			return e.appendValue(dst, val.Elem(), typeName)
+		}
+	}
+
+	// Nested structs go as CompositeDict items, recurse into them.
+	if isNestedStruct(val.Type(), typeName) {
+		dst, err = e.appendStruct(dst, val)
+		return dst, B3_COMPOSITE_DICT, false, err
+	}
+
+	// Slices and arrays go as CompositeList items, one keyless item per element.
+	if isList(val.Type(), typeName) {
+		dst, err = e.appendList(dst, val, listElemTypeName(typeName))
+		return dst, B3_COMPOSITE_LIST, false, err
+	}
+
+	// Maps go as CompositeDict items, keyed by the map keys.
+	if val.Kind() == reflect.Map {
+		dst, err = e.appendMap(dst, val, dictElemTypeName(typeName))
+		return dst, B3_COMPOSITE_DICT, false, err
+	}
+
+	if typeName == "" {
+		typeName = inferTypeName(val.Type())
+	}
+	if typeName == "" {
+		return dst, 0, false, errors.New("struct b3.type is invalid")
+	}
+	// turn into type number
+	dt, ok := e.r.LookupName(typeName)
+	if !ok {
+		return dst, 0, false, errors.New("struct b3.type name not found in b3 types")
+	}
+
+	dst, err = appendScalar(dst, val, dt)
+	return dst, dt.Number, false, err
+}
+
+// Append a whole item, header then data. The data's length is only known once it's encoded, so it goes on
+// first, then gets moved along to make room for the header in front of it.
+func (e encoder) appendItem(dst []byte, key interface{}, val reflect.Value, typeName string) ([]byte, error) {
+	start := len(dst)
+	dst, dataType, isNull, err := e.appendValue(dst, val, typeName)
+	if err != nil {
+		return dst[:start], err
+	}
+	return insertHeader(dst, start, ItemHeader{DataType: dataType, Key: key, IsNull: isNull})
+}
+
+// Put an item header in front of the data from dst[start:], which is what hdr.DataLen is set to.
+// Nulls have no data, so anything there is dropped.
+func insertHeader(dst []byte, start int, hdr ItemHeader) ([]byte, error) {
+	if hdr.IsNull {
+		dst = dst[:start]
+	}
+	hdr.DataLen = len(dst) - start
+	var scratch [32]byte // headers are small, unless they've a long key (which is fine, it just allocates)
+	hdrBuf, err := AppendHeader(scratch[:0], hdr)
+	if err != nil {
+		return dst[:start], errors.Wrap(err, "b3 item header encode fail")
+	}
+	dst = append(dst, hdrBuf...) // for the room, then shuffle the data up and put the header in front
+	copy(dst[start+len(hdrBuf):], dst[start:start+hdr.DataLen])
+	copy(dst[start:], hdrBuf)
+	return dst, nil
+}
+
+// Encode a plain value with its data type's codec. The built-in codecs are called directly, rather than
+// via an interface{} and a fresh slice, see appendBuiltin.
+func appendScalar(dst []byte, val reflect.Value, dt DataType) ([]byte, error) {
+	// Zero values always go as the compact zero-value (no data), whatever the encoder would make of them,
+	// so kept zero fields are just a header. Decoders all take no data as their zero value.
+	if val.IsZero() {
+		return dst, nil
+	}
+	if isBuiltinCodec(dt) {
+		out, handled, err := appendBuiltin(dst, val, dt.Number)
+		if err != nil {
+			return dst, err
+		}
+		if handled {
+			return out, nil
+		}
+	}
+
+	// Turn the value into an interface value for feeding to the encoders
+	ifVal, err := fieldValueForEncode(val, dt.Number) // The encoder functions take interface{} and type check themselves.
+	if err != nil {
+		return dst, err
+	}
+	buf, err := dt.Encode(ifVal)
+	if err != nil {
+		return dst, errors.Wrap(err, "data value encode fail")
+	}
+	return append(dst, buf...), nil
+}
+
+// The built-in codecs' Append functions, for the go kinds fieldValueForEncode knows, with its checks.
+// handled is false for anything else, which then goes through the codec's Encode the long way.
+func appendBuiltin(dst []byte, val reflect.Value, dataType int) (out []byte, handled bool, err error) {
+	kind := val.Kind()
+	switch dataType {
+	case B3_UVARINT:
+		if isIntKind(kind) {
+			n := val.Int()
+			if n < 0 {
+				return dst, true, errors.Errorf("value %d is negative, UVARINT is unsigned", n)
+			}
+			return AppendUvarint64(dst, uint64(n)), true, nil
+		}
+		if isUintKind(kind) {
+			return AppendUvarint64(dst, val.Uint()), true, nil
+		}
+	case B3_SVARINT:
+		if isIntKind(kind) {
+			return AppendSvarint64(dst, val.Int()), true, nil
+		}
+		if isUintKind(kind) {
+			u := val.Uint()
+			if u > math.MaxInt64 {
+				return dst, true, errors.Errorf("value %d overflows SVARINT", u)
+			}
+			return AppendSvarint64(dst, int64(u)), true, nil
+		}
+	case B3_INT64:
+		if isIntKind(kind) {
+			return AppendInt64(dst, val.Int()), true, nil
+		}
+		if isUintKind(kind) {
+			u := val.Uint()
+			if u > math.MaxInt64 {
+				return dst, true, errors.Errorf("value %d overflows INT64", u)
+			}
+			return AppendInt64(dst, int64(u)), true, nil
+		}
+	case B3_FLOAT64:
+		if kind == reflect.Float32 || kind == reflect.Float64 {
+			return AppendFloat64(dst, val.Float()), true, nil
+		}
+	case B3_COMPLEX:
+		if kind == reflect.Complex64 || kind == reflect.Complex128 {
+			return AppendComplex(dst, val.Complex()), true, nil
+		}
+	case B3_BOOL:
+		if kind == reflect.Bool {
+			return AppendBool(dst, val.Bool()), true, nil
+		}
+	case B3_UTF8:
+		if kind == reflect.String {
+			return AppendUtf8(dst, val.String()), true, nil
+		}
+	case B3_BYTES:
+		if kind == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8 {
+			return AppendBytes(dst, val.Bytes()), true, nil
+		}
+		if kind == reflect.Array && val.Type().Elem().Kind() == reflect.Uint8 {
+			for i := 0; i < val.Len(); i++ {
+				dst = append(dst, byte(val.Index(i).Uint()))
+			}
+			return dst, true, nil
+		}
+	case B3_STAMP64, B3_SCHED:
+		// Structs only go this way if they're addressable (e.g. fields of a struct that came by pointer):
+		// a pointer to them fits in an interface{} as is, a copy of them would be allocated.
+		if val.Type() == timeType && val.CanAddr() {
+			t := val.Addr().Interface().(*time.Time)
+			if dataType == B3_SCHED {
+				return AppendSched(dst, *t), true, nil
+			}
+			out, err = AppendStamp64(dst, *t)
+			return out, true, err
+		}
+	case B3_DECIMAL:
+		if val.Type() == decimalType && val.CanAddr() {
+			return AppendDecimal(dst, *val.Addr().Interface().(*Decimal)), true, nil
+		}
+	}
+	return dst, false, nil
+}
+
+// Whether dt has the built-in codec for its number (registries made with NewRegistry might not).
+func isBuiltinCodec(dt DataType) bool {
+	if dt.Number < B3_BYTES || dt.Number > B3_COMPLEX {
+		return false
+	}
+	builtin := builtinDataTypes[dt.Number-B3_BYTES]
+	return reflect.ValueOf(dt.Encode).Pointer() == reflect.ValueOf(builtin.Encode).Pointer()
+}
+
+func (e encoder) appendList(dst []byte, val reflect.Value, elemTypeName string) ([]byte, error) {
+	for i := 0; i < val.Len(); i++ {
+		var err error
+		dst, err = e.appendItem(dst, nil, val.Index(i), elemTypeName)
+		if err != nil {
+			return dst, fieldError(err, indexPath("", i))
+		}
+	}
+	return dst, nil
+}
+
+// Decode an item's data into a value, which must be settable.
+func (r *Registry) decodeValue(val reflect.Value, typeName string, hdr ItemHeader, data []byte, path string, opts DecodeOptions) error {
+	if typeName == "" {
+		typeName = structTypeName(val.Type())
+	}
+
+	// Types that decode themselves get the raw item data, and check the data type themselves.
+	// b3gen'd methods don't know about Strict or Tracer though, so those go the reflect way.
+	if (!opts.Strict && opts.Tracer == nil) || !isGenerated(val.Type()) {
+		handled, err := unmarshalField(val, typeName, hdr, data)
+		if err != nil {
+			return fieldError(err, path)
+		}
+		if handled {
+			return nil
+		}
+	}
+
+	// interface{}s (e.g. the values of a map[string]interface{}) get whatever UnpackDict would give them.
+	if val.Kind() == reflect.Interface {
+		value, err := r.unpackValue(hdr, data, keyModeMixed)
+		if err != nil {
+			return fieldError(err, path)
+		}
+		if value == nil {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+		rv := reflect.ValueOf(value)
+		if !rv.Type().AssignableTo(val.Type()) {
+			return fieldError(errors.Errorf("cannot set %s from decoded %T", val.Type(), value), path)
+		}
+		val.Set(rv)
+		return nil
+	}
+
+	// Null items make nil pointers, whatever their data type (e.g. python's None goes as type 0).
+	// Otherwise decode into what they point at, allocating it if need be.
+	if val.Kind() == reflect.Ptr {
+		if hdr.IsNull {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+		if val.Type() != bigIntPtrType {
+			if val.IsNil() {
+				val.Set(reflect.New(val.Type().Elem()))
+			}
+			return r.decodeValue(val.Elem(), typeName, hdr, data, path, opts)
+		}
+	}
+
+	// Nested structs come in as CompositeDict items, recurse into them.
+	if isNestedStruct(val.Type(), typeName) {
+		if hdr.DataType != B3_COMPOSITE_DICT {
+			return fieldError(errors.New("struct field b3 type mismatch vs incoming data type"), path)
+		}
+		if hdr.IsNull {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+		return r.fillStruct(data, val, path, opts)
+	}
+
+	if isList(val.Type(), typeName) {
+		if hdr.DataType != B3_COMPOSITE_LIST {
+			return fieldError(errors.New("struct field b3 type mismatch vs incoming data type"), path)
+		}
+		if hdr.IsNull {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+		return r.fillList(data, val, listElemTypeName(typeName), path, opts)
+	}
+
+	if val.Kind() == reflect.Map {
+		if hdr.DataType != B3_COMPOSITE_DICT {
+			return fieldError(errors.New("struct field b3 type mismatch vs incoming data type"), path)
+		}
+		if hdr.IsNull {
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		}
+		return r.fillMap(data, val, dictElemTypeName(typeName), path, opts)
+	}
+
+	if typeName == "" {
+		typeName = inferTypeName(val.Type())
+	}
+	if typeName == "" {
+		return fieldError(errors.New("struct b3.type is missing"), path)
+	}
+	dt, ok := r.LookupName(typeName)
+	if !ok {
+		return fieldError(errors.New("struct b3.type name not found in b3 types"), path)
+	}
+	return decodeScalar(val, dt, hdr, data, path)
+}
+
+// Decode a plain value with its data type's codec.
+func decodeScalar(val reflect.Value, dt DataType, hdr ItemHeader, data []byte, path string) error {
+	// ensure the b3 types match!
+	if hdr.DataType != dt.Number {
+		return fieldError(errors.New("struct field b3 type mismatch vs incoming data type"), path)
+	}
+
+	// Policy:  incoming b3 nulls -> go zero-values, for fields that aren't pointers or Null* types.
+	if hdr.IsNull {
+		data = []byte{}
+	}
+	decodedValue, err := dt.Decode(data)
+	if err != nil {
+		return fieldError(errors.Wrap(err, "b3 type decoder fail"), path)
+	}
+	if err := setFieldValue(val, decodedValue); err != nil {
+		return fieldError(err, path)
+	}
+	return nil
+}
+
+// Items are sorted by key, like PackDict, so the output is stable.
+func (e encoder) appendMap(dst []byte, val reflect.Value, elemTypeName string) ([]byte, error) {
+	items := make([]dictItem, 0, val.Len())
+	iter := val.MapRange()
+	for iter.Next() {
+		key, err := itemKeyFromMapKey(iter.Key())
+		if err != nil {
+			return dst, err
+		}
+		items = append(items, dictItem{key, iter.Value()})
+	}
+	sortDictItems(items)
+
+	for _, item := range items {
+		var err error
+		dst, err = e.appendItem(dst, item.key, item.value.(reflect.Value), elemTypeName)
+		if err != nil {
+			return dst, fieldError(err, keyPath("", item.key))
+		}
+	}
+	return dst, nil
+}
+
+// Slices get a fresh backing array (nil if the list is empty), arrays are filled in place and the rest zeroed.
+func (r *Registry) fillList(buf []byte, val reflect.Value, elemTypeName string, path string, opts DecodeOptions) error {
+	isArray := val.Kind() == reflect.Array
+	elemType := val.Type().Elem()
+	out := reflect.Zero(val.Type())
+	if isArray {
+		val.Set(out)
+	}
+
+	n := 0
+	index := 0
+	for index < len(buf) {
+		hdr, bytesUsed, err := DecodeHeader(buf[index:])
+		if err != nil {
+			return fieldError(errors.Wrap(err, "list decode header fail"), path)
+		}
+		index += bytesUsed
+		if opts.Tracer != nil {
+			opts.Tracer.HeaderDecoded(path, hdr)
+		}
+		if hdr.Key != nil {
+			return fieldError(errors.Errorf("list item has a key (%v)", hdr.Key), path)
+		}
+		if hdr.DataLen > len(buf)-index {
+			return fieldError(errors.New("item data len > buffer"), path)
+		}
+		itemData := buf[index : index+hdr.DataLen]
+		index += hdr.DataLen
+
+		var elem reflect.Value
+		if isArray {
+			if n >= val.Len() {
+				return fieldError(errors.Errorf("list has more than %d items for %s", val.Len(), val.Type()), path)
+			}
+			elem = val.Index(n)
+		} else {
+			elem = reflect.New(elemType).Elem()
+		}
+		if err := r.decodeValue(elem, elemTypeName, hdr, itemData, indexPath(path, n), opts); err != nil {
+			return err
+		}
+		if !isArray {
+			out = reflect.Append(out, elem)
+		}
+		n++
+	}
+
+	if !isArray {
+		val.Set(out)
+	}
+	return nil
+}
+
+// Maps get a fresh map (nil if the dict is empty), like slices.
+func (r *Registry) fillMap(buf []byte, val reflect.Value, elemTypeName string, path string, opts DecodeOptions) error {
+	mapType := val.Type()
+	out := reflect.Zero(mapType)
+
+	index := 0
+	for index < len(buf) {
+		hdr, bytesUsed, err := DecodeHeader(buf[index:])
+		if err != nil {
+			return fieldError(errors.Wrap(err, "dict decode header fail"), path)
+		}
+		index += bytesUsed
+		if opts.Tracer != nil {
+			opts.Tracer.HeaderDecoded(path, hdr)
+		}
+		if hdr.DataLen > len(buf)-index {
+			return fieldError(errors.New("item data len > buffer"), path)
+		}
+		itemData := buf[index : index+hdr.DataLen]
+		index += hdr.DataLen
+
+		key, err := mapKeyFromItemKey(hdr.Key, mapType.Key())
+		if err != nil {
+			return fieldError(err, path)
+		}
+		elem := reflect.New(mapType.Elem()).Elem()
+		if err := r.decodeValue(elem, elemTypeName, hdr, itemData, keyPath(path, hdr.Key), opts); err != nil {
+			return err
+		}
+		if out.IsNil() {
+			out = reflect.MakeMap(mapType)
+		}
+		out.SetMapIndex(key, elem)
+	}
+
+	val.Set(out)
+	return nil
+}
+
+// Map keys of int kinds are int item keys, string kinds are string keys, and byte arrays are bytes keys.
+func itemKeyFromMapKey(key reflect.Value) (interface{}, error) {
+	kind := key.Kind()
+	switch {
+	case isIntKind(kind):
+		if n := key.Int(); n > int64(maxInt) || n < -int64(maxInt)-1 {
+			return nil, errors.Errorf("dict key %d overflows int", n)
+		}
+		return int(key.Int()), nil
+	case isUintKind(kind):
+		if key.Uint() > uint64(maxInt) {
+			return nil, errors.Errorf("dict key %d overflows int", key.Uint())
+		}
+		return int(key.Uint()), nil
+	case kind == reflect.String:
+		return key.String(), nil
+	case kind == reflect.Array && key.Type().Elem().Kind() == reflect.Uint8:
+		return byteArrayBytes(key), nil
+	}
+	return nil, errors.Errorf("map key type %s not supported (int, string or byte array kinds)", key.Type())
+}
+
+func mapKeyFromItemKey(itemKey interface{}, keyType reflect.Type) (reflect.Value, error) {
+	key := reflect.New(keyType).Elem()
+	kind := keyType.Kind()
+	switch k := itemKey.(type) {
+	case nil:
+		return key, errors.New("dict item has no key")
+	case int:
+		if isIntKind(kind) {
+			return key, errors.Wrap(setInt(key, int64(k), k), "dict key")
+		}
+		if isUintKind(kind) {
+			return key, errors.Wrap(setUint(key, uint64(k), k), "dict key") // item keys are never -ve
+		}
+		return key, errors.Errorf("dict key %d is not a %s", k, keyType)
+	case string:
+		if kind == reflect.String {
+			key.SetString(k)
+			return key, nil
+		}
+		return key, errors.Errorf("dict key %q is not a %s", k, keyType)
+	case []byte:
+		if kind == reflect.Array && keyType.Elem().Kind() == reflect.Uint8 && len(k) == keyType.Len() {
+			reflect.Copy(key, reflect.ValueOf(k))
+			return key, nil
+		}
+		return key, errors.Errorf("dict key %x is not a %s", k, keyType)
+	}
+	return key, errors.Errorf("dict key type %T not supported", itemKey)
+}
+
+// A struct with no b3.type, or b3.type DICT, is a nested struct.
+// Structs with their own data type (time.Time, Decimal...) have a b3.type, so don't end up here.
+func isNestedStruct(t reflect.Type, typeName string) bool {
+	return (typeName == "" || typeName == "DICT") && t.Kind() == reflect.Struct
+}
+
+// The data type for the null item of a nil pointer to t. The other end doesn't need it to decode a null,
+// but it's what the item would have been, and the python version does the same.
+func (r *Registry) nullDataType(t reflect.Type, typeName string) int {
+	dt, named := r.LookupName(typeName)
+	if isGenerated(t) {
+		return B3_COMPOSITE_DICT // a struct, just with its own methods
+	}
+	if methodsOf(t).any()&hasB3Marshaler != 0 {
+		return dt.Number // 0 if there's no b3.type, it's only known once it's marshaled
+	}
+	switch {
+	case isNestedStruct(t, typeName), t.Kind() == reflect.Map:
+		return B3_COMPOSITE_DICT
+	case isList(t, typeName):
+		return B3_COMPOSITE_LIST
+	}
+	if !named && typeName == "" {
+		dt, named = r.LookupName(inferTypeName(t))
+	}
+	if named {
+		return dt.Number
+	}
+	return 0
+}
+
+// Slices and arrays are lists, except []byte and [N]byte, which are a single BYTES item unless b3.type says
+// otherwise (e.g. b3.type:"UVARINT" for a list of small numbers).
+func isList(t reflect.Type, typeName string) bool {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+	return !((typeName == "" || typeName == "BYTES") && t.Elem().Kind() == reflect.Uint8)
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	decimalType = reflect.TypeOf(Decimal{})
+)
+
+// The b3.type for a value that doesn't have one, from its go kind. Only for the obvious cases - ints are
+// SVARINT because they might be -ve, an explicit b3.type:"UVARINT" is smaller for ones that never are.
+func inferTypeName(t reflect.Type) string {
+	if name := structTypeName(t); name != "" {
+		return name
+	}
+	if class := b3tag.KindClass(t); class != "" {
+		return b3tag.ClassDataTypes[class][0] // same table as cmd/b3gen
+	}
+	return ""
+}
+
+// Whether a go type can go as data type dt, by the same table as cmd/b3gen. Types outside the table (and
+// data types that aren't the built-in codecs) are left to the codec to take or not. Struct fields are checked
+// when their schema is compiled (see checkFieldType), so a zero value, which goes as no data whatever its
+// data type, can't hide a mismatch until the value isn't zero.
+func checkScalarType(t reflect.Type, dt DataType) error {
+	class := typeClass(t)
+	if class == "" || !isBuiltinCodec(dt) {
+		return nil
+	}
+	for _, name := range b3tag.ClassDataTypes[class] {
+		if name == dt.Name {
+			return nil
+		}
+	}
+	return errors.Errorf("b3.type %s doesn't go with %s", dt.Name, t)
+}
+
+// The b3tag class of a go type, "" if it isn't one b3tag knows.
+func typeClass(t reflect.Type) string {
+	switch t {
+	case timeType:
+		return "time"
+	case decimalType:
+		return "decimal"
+	case bigIntPtrType:
+		return "bigint"
+	}
+	return b3tag.KindClass(t)
+}
+
+// Structs that are b3 types in their own right. These have to be worked out before marshalField gets a
+// look in, because time.Time also has MarshalBinary and would otherwise go as BYTES (and *big.Int has
+// MarshalText, and would go as UTF8).
+func structTypeName(t reflect.Type) string {
+	if t == bigIntPtrType {
+		return b3tag.ClassDataTypes["bigint"][0]
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return b3tag.ClassDataTypes["time"][0]
+	case decimalType:
+		return b3tag.ClassDataTypes["decimal"][0]
+	}
+	return ""
+}
+
+// b3.type LIST just says 'this is a list', the elements then need to be something that doesn't need a b3.type.
+func listElemTypeName(typeName string) string {
+	if typeName == "LIST" {
+		return ""
+	}
+	return typeName
+}
+
+// b3.type DICT on a map just says 'this is a dict', same as LIST for slices.
+func dictElemTypeName(typeName string) string {
+	if typeName == "DICT" {
+		return ""
+	}
+	return typeName
+}
+
+func keyPath(path string, key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return fmt.Sprintf("%s[%q]", path, k)
+	case []byte:
+		return fmt.Sprintf("%s[%x]", path, k)
+	}
+	return fmt.Sprintf("%s[%v]", path, key)
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
@@ -0,0 +1,301 @@
+package b3
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type listStruct struct {
+	Tags   []string       `b3.tag:"1" b3.type:"UTF8"`
+	Nums   []int          `b3.tag:"2" b3.type:"SVARINT"`
+	Inners []nestedInner  `b3.tag:"3" b3.type:"LIST"`
+	ID     [4]byte        `b3.tag:"4" b3.type:"BYTES"`
+	Small  [3]uint8       `b3.tag:"5" b3.type:"UVARINT"`
+	Grid   [][]int        `b3.tag:"6" b3.type:"SVARINT"`
+	Ptrs   []*nestedInner `b3.tag:"7"`
+}
+
+func TestStructListRoundTrip(t *testing.T) {
+	src := listStruct{
+		Tags:   []string{"a", "", "foo"},
+		Nums:   []int{-1, 0, 1000000},
+		Inners: []nestedInner{{1, 2}, {-3, -4}},
+		ID:     [4]byte{0xde, 0xad, 0xbe, 0xef},
+		Small:  [3]uint8{1, 2, 255},
+		Grid:   [][]int{{1, 2}, {}, {3}},
+		Ptrs:   []*nestedInner{{5, 6}, nil},
+	}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := listStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	src.Grid[1] = nil // empty lists decode to nil slices
+	assert.Equal(t, src, dst)
+}
+
+func TestStructListBytes(t *testing.T) {
+	type tagsStruct struct {
+		Tags []string `b3.tag:"1" b3.type:"UTF8"`
+	}
+	src := tagsStruct{[]string{"a", "bc"}}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     list len 7  utf8 "a"  utf8 "bc"
+	assert.Equal(t, SBytes("52 01 07 44 01 61 44 02 62 63"), buf)
+
+	dst := tagsStruct{[]string{"old", "old", "old"}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructListEmpty(t *testing.T) {
+	src := listStruct{}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := listStruct{Tags: []string{"x"}, Small: [3]uint8{1, 2, 3}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructArrayBounds(t *testing.T) {
+	type bigSmall struct {
+		Small []uint8 `b3.tag:"5" b3.type:"UVARINT"`
+	}
+	type bigID struct {
+		ID []byte `b3.tag:"4" b3.type:"BYTES"`
+	}
+
+	// shorter lists zero the rest of the array
+	buf, err := StructToBuf(bigSmall{[]uint8{7}})
+	assert.Nil(t, err)
+	dst := listStruct{Small: [3]uint8{1, 2, 3}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, [3]uint8{7, 0, 0}, dst.Small)
+
+	buf, err = StructToBuf(bigSmall{[]uint8{1, 2, 3, 4}})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.EqualError(t, err, "struct field Small: list has more than 3 items for [3]uint8")
+
+	buf, err = StructToBuf(bigID{[]byte{1, 2, 3, 4, 5}})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.EqualError(t, err, "struct field ID: 5 bytes doesn't fit [4]uint8 field")
+
+	// short data is an error too, rather than zero padding it
+	buf, err = StructToBuf(bigID{[]byte{1, 2, 3}})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.EqualError(t, err, "struct field ID: 3 bytes doesn't fit [4]uint8 field")
+}
+
+func TestStructListErrorPath(t *testing.T) {
+	type wideInners struct {
+		Inners []wideInner `b3.tag:"3"`
+	}
+	buf, err := StructToBuf(wideInners{[]wideInner{{1}, {300}}})
+	assert.Nil(t, err)
+	dst := listStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.EqualError(t, err, "struct field Inners[1].Small: value 300 overflows int8 field")
+
+	type negGrid struct {
+		Grid [][]int `b3.tag:"6" b3.type:"UVARINT"`
+	}
+	_, err = StructToBuf(negGrid{[][]int{{1}, {2, -3}}})
+	assert.EqualError(t, err, "struct field Grid[1][1]: value -3 is negative, UVARINT is unsigned")
+
+	// list data arriving for a scalar field, and vice versa
+	buf, err = StructToBuf(svarintStruct{Delta: 1})
+	assert.Nil(t, err)
+	type deltas struct {
+		Delta []int `b3.tag:"1" b3.type:"SVARINT"`
+	}
+	err = BufToStruct(buf, len(buf), &deltas{})
+	assert.EqualError(t, err, "struct field Delta: struct field b3 type mismatch vs incoming data type")
+}
+
+type mapStruct struct {
+	Prices map[string]int              `b3.tag:"1" b3.type:"SVARINT"`
+	Names  map[uint16]string           `b3.tag:"2" b3.type:"UTF8"`
+	Inners map[string]nestedInner      `b3.tag:"3" b3.type:"DICT"`
+	Hashes map[[2]byte]bool            `b3.tag:"4" b3.type:"BOOL"`
+	Lists  map[int][]string            `b3.tag:"5" b3.type:"UTF8"`
+	Nested map[string]map[int8]float64 `b3.tag:"6" b3.type:"FLOAT64"`
+}
+
+func TestStructMapRoundTrip(t *testing.T) {
+	src := mapStruct{
+		Prices: map[string]int{"apple": 3, "pear": -7},
+		Names:  map[uint16]string{1: "one", 65535: "big"},
+		Inners: map[string]nestedInner{"x": {1, 2}},
+		Hashes: map[[2]byte]bool{{0xbe, 0xef}: true, {0, 1}: false},
+		Lists:  map[int][]string{0: {"a", "b"}},
+		Nested: map[string]map[int8]float64{"pi": {3: 3.14}},
+	}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := mapStruct{Prices: map[string]int{"old": 1}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructMapBytes(t *testing.T) {
+	type ages struct {
+		Ages map[string]int `b3.tag:"1" b3.type:"UVARINT"`
+	}
+	src := ages{map[string]int{"bo": 5, "al": 0}}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     dict len 10 "al" uvarint 0  "bo" uvarint 5		sorted by key
+	assert.Equal(t, SBytes("51 01 0a 27 02 61 6c 67 02 62 6f 01 05"), buf)
+
+	dst := ages{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+
+	err = BufToStruct(SBytes("51 01 00"), 3, &dst)
+	assert.Nil(t, err)
+	assert.Nil(t, dst.Ages) // empty dicts decode to nil maps
+}
+
+func TestStructMapErrors(t *testing.T) {
+	type intKeys struct {
+		Prices map[int]int `b3.tag:"1" b3.type:"SVARINT"`
+	}
+	buf, err := StructToBuf(intKeys{map[int]int{1: 1}})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &mapStruct{})
+	assert.EqualError(t, err, "struct field Prices: dict key 1 is not a string")
+
+	type wideKeys struct {
+		Names map[int]string `b3.tag:"2" b3.type:"UTF8"`
+	}
+	buf, err = StructToBuf(wideKeys{map[int]string{70000: "x"}})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &mapStruct{})
+	assert.EqualError(t, err, "struct field Names: dict key: value 70000 overflows uint16 field")
+
+	type wideValues struct {
+		Nested map[string]map[int8]string `b3.tag:"6" b3.type:"UTF8"`
+	}
+	buf, err = StructToBuf(wideValues{map[string]map[int8]string{"pi": {3: "x"}}})
+	assert.Nil(t, err)
+	err = BufToStruct(buf, len(buf), &mapStruct{})
+	assert.EqualError(t, err, `struct field Nested["pi"][3]: struct field b3 type mismatch vs incoming data type`)
+
+	type badKeys struct {
+		M map[float64]int `b3.tag:"1" b3.type:"SVARINT"`
+	}
+	_, err = StructToBuf(badKeys{map[float64]int{1.5: 1}})
+	assert.EqualError(t, err, "struct field M: map key type float64 not supported (int, string or byte array kinds)")
+
+	_, err = StructToBuf(mapStruct{Names: map[uint16]string{1: "a"}, Prices: map[string]int{}, Lists: map[int][]string{-1: nil}})
+	assert.EqualError(t, err, "struct field Lists[-1]: b3 item header encode fail: negative int keys are not supported")
+}
+
+type inferredStruct struct {
+	Name  string          `b3.tag:"1"`
+	Data  []byte          `b3.tag:"2"`
+	Count uint            `b3.tag:"3"`
+	Delta int             `b3.tag:"4"`
+	Ratio float64         `b3.tag:"5"`
+	Flag  bool            `b3.tag:"6"`
+	When  time.Time       `b3.tag:"7"`
+	Small int8            `b3.tag:"8"`
+	Hash  [2]byte         `b3.tag:"9"`
+	Price Decimal         `b3.tag:"10"`
+	Nums  []int           `b3.tag:"11"`
+	Ages  map[string]uint `b3.tag:"12"`
+	Maybe *time.Time      `b3.tag:"13"`
+	Big   int             `b3.tag:"14" b3.type:"INT64"` // explicit b3.type wins
+}
+
+func TestStructInferTypes(t *testing.T) {
+	when := time.Date(2020, 10, 21, 1, 2, 3, 456, time.UTC)
+	src := inferredStruct{"foo", []byte{1}, 2, -3, 4.5, true, when, -6, [2]byte{7, 8}, NewDecimal(big.NewInt(9), -1),
+		[]int{-1, 1}, map[string]uint{"a": 1}, &when, 1}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	m, err := UnpackDict(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", m[1])
+	assert.Equal(t, []byte{1}, m[2])
+	assert.Equal(t, 2, m[3])
+	assert.Equal(t, -3, m[4])
+	assert.Equal(t, 4.5, m[5])
+	assert.Equal(t, true, m[6])
+	assert.Equal(t, when, m[7]) // STAMP64, not MarshalBinary BYTES
+	assert.Equal(t, []byte{7, 8}, m[9])
+	assert.Equal(t, []interface{}{-1, 1}, m[11])
+	assert.Equal(t, int64(1), m[14])
+
+	dst := inferredStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestStructInferBytes(t *testing.T) {
+	type small struct {
+		Delta int   `b3.tag:"1"`
+		Count uint8 `b3.tag:"2"`
+	}
+	buf, err := StructToBuf(small{-1, 1})
+	assert.Nil(t, err)
+	//                     svarint -1  uvarint 1
+	assert.Equal(t, SBytes("58 01 01 01 57 02 01 01"), buf)
+
+	type nilTime struct {
+		When *time.Time `b3.tag:"1"`
+	}
+	buf, err = StructToBuf(nilTime{})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("9c 01"), buf) // null STAMP64
+}
+
+func TestStructInferFail(t *testing.T) {
+	type chanStruct struct {
+		C chan int `b3.tag:"1"`
+	}
+	_, err := StructToBuf(chanStruct{})
+	assert.EqualError(t, err, "struct field C: struct b3.type is invalid")
+	err = BufToStruct(SBytes("57 01 01 01"), 4, &chanStruct{})
+	assert.EqualError(t, err, "struct field C: struct b3.type is missing")
+}
+
+func TestStructTypeMismatch(t *testing.T) {
+	type stringUvarint struct {
+		Name string `b3.tag:"1" b3.type:"UVARINT"`
+	}
+	type timeBool struct {
+		When time.Time `b3.tag:"1" b3.type:"BOOL"`
+	}
+	// zero values too, not just once they're set (it's a schema error, see TestSchemaErrors)
+	_, err := StructToBuf(stringUvarint{})
+	assert.EqualError(t, err, "struct field Name: b3.type UVARINT doesn't go with string")
+	_, err = StructToBuf(stringUvarint{"x"})
+	assert.EqualError(t, err, "struct field Name: b3.type UVARINT doesn't go with string")
+	_, err = StructToBuf(timeBool{})
+	assert.EqualError(t, err, "struct field When: b3.type BOOL doesn't go with time.Time")
+
+	// the same goes for list elements
+	type listUvarint struct {
+		Names []string `b3.tag:"1" b3.type:"UVARINT"`
+	}
+	_, err = StructToBuf(listUvarint{[]string{""}})
+	assert.EqualError(t, err, "struct field Names: b3.type UVARINT doesn't go with string")
+}
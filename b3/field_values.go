@@ -0,0 +1,230 @@
+package b3
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// The codecs only deal in a handful of concrete types (int, uint64, int64, float64, complex128 ...),
+// but struct fields can be any width, or named types like "type Age uint8".
+// These two sit between reflect and the codecs and do the widening/narrowing, with overflow checks,
+// so the codecs can stay dumb and Set() never panics on a mismatch.
+
+var bigIntPtrType = reflect.TypeOf((*big.Int)(nil))
+
+// Widen a struct field value to the concrete type the data type's encoder wants.
+func fieldValueForEncode(fieldVal reflect.Value, dataType int) (interface{}, error) {
+	kind := fieldVal.Kind()
+	switch dataType {
+	case B3_UVARINT:
+		if isIntKind(kind) {
+			n := fieldVal.Int()
+			if n < 0 {
+				return nil, errors.Errorf("value %d is negative, UVARINT is unsigned", n)
+			}
+			return uint64(n), nil
+		}
+		if isUintKind(kind) {
+			return fieldVal.Uint(), nil
+		}
+	case B3_SVARINT: // int64s, not ints, which are 32 bits on some platforms
+		if isIntKind(kind) {
+			return fieldVal.Int(), nil
+		}
+		if isUintKind(kind) {
+			u := fieldVal.Uint()
+			if u > math.MaxInt64 {
+				return nil, errors.Errorf("value %d overflows SVARINT", u)
+			}
+			return int64(u), nil
+		}
+		if v, ok := fieldVal.Interface().(*big.Int); ok && v != nil {
+			if !v.IsInt64() {
+				return nil, errors.Errorf("value %s overflows SVARINT", v)
+			}
+			return v.Int64(), nil
+		}
+	case B3_INT64:
+		if isIntKind(kind) {
+			return fieldVal.Int(), nil
+		}
+		if isUintKind(kind) {
+			u := fieldVal.Uint()
+			if u > math.MaxInt64 {
+				return nil, errors.Errorf("value %d overflows INT64", u)
+			}
+			return int64(u), nil
+		}
+	case B3_FLOAT64:
+		if kind == reflect.Float32 || kind == reflect.Float64 {
+			return fieldVal.Float(), nil
+		}
+	case B3_COMPLEX:
+		if kind == reflect.Complex64 || kind == reflect.Complex128 {
+			return fieldVal.Complex(), nil
+		}
+	case B3_BOOL:
+		if kind == reflect.Bool {
+			return fieldVal.Bool(), nil
+		}
+	case B3_UTF8:
+		if kind == reflect.String {
+			return fieldVal.String(), nil
+		}
+	case B3_BYTES:
+		if kind == reflect.Slice && fieldVal.Type().Elem().Kind() == reflect.Uint8 {
+			return fieldVal.Bytes(), nil
+		}
+		if kind == reflect.Array && fieldVal.Type().Elem().Kind() == reflect.Uint8 {
+			return byteArrayBytes(fieldVal), nil
+		}
+	}
+	return fieldVal.Interface(), nil
+}
+
+// Fit a decoded value into a struct field, narrowing numbers if they fit and erroring if they don't.
+// Note decoded UVARINTs are int, uint64 or *big.Int depending on how big they are (see CodecDecodeUvarint).
+func setFieldValue(fieldVal reflect.Value, decodedValue interface{}) error {
+	fieldType := fieldVal.Type()
+	kind := fieldVal.Kind()
+
+	if fieldType == bigIntPtrType {
+		switch v := decodedValue.(type) {
+		case int:
+			fieldVal.Set(reflect.ValueOf(big.NewInt(int64(v))))
+			return nil
+		case int64:
+			fieldVal.Set(reflect.ValueOf(big.NewInt(v)))
+			return nil
+		case uint64:
+			fieldVal.Set(reflect.ValueOf(new(big.Int).SetUint64(v)))
+			return nil
+		}
+	}
+
+	switch {
+	case isIntKind(kind):
+		switch v := decodedValue.(type) {
+		case int:
+			return setInt(fieldVal, int64(v), v)
+		case int64:
+			return setInt(fieldVal, v, v)
+		case uint64:
+			if v > math.MaxInt64 {
+				return overflowError(fieldType, v)
+			}
+			return setInt(fieldVal, int64(v), v)
+		case *big.Int:
+			if !v.IsInt64() {
+				return overflowError(fieldType, v)
+			}
+			return setInt(fieldVal, v.Int64(), v)
+		}
+
+	case isUintKind(kind):
+		switch v := decodedValue.(type) {
+		case int:
+			if v < 0 {
+				return overflowError(fieldType, v)
+			}
+			return setUint(fieldVal, uint64(v), v)
+		case int64:
+			if v < 0 {
+				return overflowError(fieldType, v)
+			}
+			return setUint(fieldVal, uint64(v), v)
+		case uint64:
+			return setUint(fieldVal, v, v)
+		case *big.Int:
+			if !v.IsUint64() {
+				return overflowError(fieldType, v)
+			}
+			return setUint(fieldVal, v.Uint64(), v)
+		}
+
+	case kind == reflect.Float32 || kind == reflect.Float64:
+		if v, ok := decodedValue.(float64); ok {
+			if fieldVal.OverflowFloat(v) {
+				return overflowError(fieldType, v)
+			}
+			fieldVal.SetFloat(v)
+			return nil
+		}
+
+	case kind == reflect.Complex64 || kind == reflect.Complex128:
+		if v, ok := decodedValue.(complex128); ok {
+			if fieldVal.OverflowComplex(v) {
+				return overflowError(fieldType, v)
+			}
+			fieldVal.SetComplex(v)
+			return nil
+		}
+
+	case kind == reflect.Bool:
+		if v, ok := decodedValue.(bool); ok {
+			fieldVal.SetBool(v)
+			return nil
+		}
+
+	case kind == reflect.String:
+		if v, ok := decodedValue.(string); ok {
+			fieldVal.SetString(v)
+			return nil
+		}
+
+	case kind == reflect.Array && fieldType.Elem().Kind() == reflect.Uint8:
+		if v, ok := decodedValue.([]byte); ok {
+			if len(v) != 0 && len(v) != fieldVal.Len() { // (no bytes is the compact zero-value)
+				return errors.Errorf("%d bytes doesn't fit %s field", len(v), fieldType)
+			}
+			fieldVal.Set(reflect.Zero(fieldType))
+			reflect.Copy(fieldVal, reflect.ValueOf(v))
+			return nil
+		}
+	}
+
+	refVal := reflect.ValueOf(decodedValue)
+	if !refVal.IsValid() || !refVal.Type().AssignableTo(fieldType) {
+		return errors.Errorf("cannot set %s field from decoded %T", fieldType, decodedValue)
+	}
+	fieldVal.Set(refVal)
+	return nil
+}
+
+// [N]byte fields may not be addressable (struct passed by value) so can't always be sliced, copy instead.
+func byteArrayBytes(fieldVal reflect.Value) []byte {
+	out := make([]byte, fieldVal.Len())
+	reflect.Copy(reflect.ValueOf(out), fieldVal)
+	return out
+}
+
+func setInt(fieldVal reflect.Value, n int64, orig interface{}) error {
+	if fieldVal.OverflowInt(n) {
+		return overflowError(fieldVal.Type(), orig)
+	}
+	fieldVal.SetInt(n)
+	return nil
+}
+
+func setUint(fieldVal reflect.Value, n uint64, orig interface{}) error {
+	if fieldVal.OverflowUint(n) {
+		return overflowError(fieldVal.Type(), orig)
+	}
+	fieldVal.SetUint(n)
+	return nil
+}
+
+func overflowError(fieldType reflect.Type, value interface{}) error {
+	return errors.Errorf("value %v overflows %s field", value, fieldType)
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uintptr
+}
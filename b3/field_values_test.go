@@ -0,0 +1,97 @@
+package b3
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type allWidthsStruct struct {
+	I8     int8      `b3.tag:"1"  b3.type:"SVARINT"`
+	I16    int16     `b3.tag:"2"  b3.type:"SVARINT"`
+	I32    int32     `b3.tag:"3"  b3.type:"SVARINT"`
+	I64    int64     `b3.tag:"4"  b3.type:"SVARINT"`
+	U      uint      `b3.tag:"5"  b3.type:"UVARINT"`
+	U8     uint8     `b3.tag:"6"  b3.type:"UVARINT"`
+	U16    uint16    `b3.tag:"7"  b3.type:"UVARINT"`
+	U32    uint32    `b3.tag:"8"  b3.type:"UVARINT"`
+	Fixed  int32     `b3.tag:"9"  b3.type:"INT64"`
+	UFixed uint16    `b3.tag:"10" b3.type:"INT64"`
+	F32    float32   `b3.tag:"11" b3.type:"FLOAT64"`
+	C64    complex64 `b3.tag:"12" b3.type:"COMPLEX"`
+	Age    myUint8   `b3.tag:"13" b3.type:"UVARINT"`
+	Name   myString  `b3.tag:"14" b3.type:"UTF8"`
+}
+
+type myUint8 uint8
+type myString string
+
+func TestFieldAllWidthsRoundTrip(t *testing.T) {
+	src := allWidthsStruct{
+		math.MinInt8, math.MinInt16, math.MinInt32, math.MinInt64,
+		math.MaxUint64, math.MaxUint8, math.MaxUint16, math.MaxUint32,
+		-5, 65535, 1.5, complex(1.5, -2.5), 42, "foo",
+	}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := allWidthsStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestFieldEncodeErrors(t *testing.T) {
+	type negUvarint struct {
+		N int16 `b3.tag:"1" b3.type:"UVARINT"`
+	}
+	_, err := StructToBuf(negUvarint{-1})
+	assert.EqualError(t, err, "struct field N: value -1 is negative, UVARINT is unsigned")
+
+	type bigSvarint struct {
+		N uint64 `b3.tag:"1" b3.type:"SVARINT"`
+	}
+	_, err = StructToBuf(bigSvarint{math.MaxUint64})
+	assert.EqualError(t, err, "struct field N: value 18446744073709551615 overflows SVARINT")
+}
+
+func TestFieldDecodeOverflow(t *testing.T) {
+	tests := []struct {
+		buf []byte
+		msg string
+	}{
+		{SBytes("58 01 02 80 02"), "struct field I8: value 128 overflows int8 field"},  // svarint 128
+		{SBytes("57 06 02 80 02"), "struct field U8: value 256 overflows uint8 field"}, // uvarint 256
+		{SBytes("57 05 0a ff ff ff ff ff ff ff ff ff 01"), ""},                         // MaxUint64 fits uint
+		{SBytes("56 09 08 00 00 00 80 00 00 00 00"), "struct field Fixed: value 2147483648 overflows int32 field"},
+		{SBytes("56 0a 08 ff ff ff ff ff ff ff ff"), "struct field UFixed: value -1 overflows uint16 field"},
+		{SBytes("59 0b 08 00 00 00 00 00 00 f0 47"), "struct field F32: value 3.402823669209385e+38 overflows float32 field"},
+	}
+	for _, test := range tests {
+		dst := allWidthsStruct{}
+		err := BufToStruct(test.buf, len(test.buf), &dst)
+		if test.msg == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.EqualError(t, err, test.msg)
+		}
+	}
+}
+
+func TestFieldSetValue(t *testing.T) {
+	var bi *big.Int
+	err := setFieldValue(reflect.ValueOf(&bi).Elem(), int64(-7))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-7), bi.Int64())
+
+	var i64 int64
+	err = setFieldValue(reflect.ValueOf(&i64).Elem(), new(big.Int).Lsh(big.NewInt(1), 70))
+	assert.Error(t, err)
+
+	var s string
+	err = setFieldValue(reflect.ValueOf(&s).Elem(), 5)
+	assert.EqualError(t, err, "cannot set string field from decoded int")
+}
@@ -0,0 +1,303 @@
+package b3
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Support for the MarshalB3/UnmarshalB3 methods written by cmd/b3gen. The generated code calls EncodeHeader,
+// DecodeHeader and the codecs itself, these are the bits of checking and narrowing that would otherwise be
+// pasted into every method. They're exported for the generated code, not really for calling directly.
+
+// B3Generated marks the types b3gen wrote methods for. StructToBuf and BufToStruct use the generated methods
+// for these, except with non-default EncodeOptions, which the generated code doesn't know about.
+type B3Generated interface {
+	B3Generated()
+}
+
+var b3GeneratedType = reflect.TypeOf((*B3Generated)(nil)).Elem()
+
+// B3Appender is the AppendB3 method b3gen writes, which appends the type's CompositeDict data to dst like
+// AppendStruct does (MarshalB3 is AppendB3 to a new slice). AppendStruct and StructToBuf call it, rather than
+// MarshalB3, so generated types encode into the caller's buffer without the copy.
+type B3Appender interface {
+	AppendB3(dst []byte) ([]byte, error)
+}
+
+var b3AppenderType = reflect.TypeOf((*B3Appender)(nil)).Elem()
+
+func isGenerated(t reflect.Type) bool {
+	return methodsOf(t).any()&hasB3Generated != 0
+}
+
+// GenFieldError names the struct field an error is about. Each struct's methods name their own fields, and the
+// ones they're in go in front as the error comes back up, so the path is the same as the reflect path's,
+// e.g. "struct field Lines[1].Qty: ...".
+func GenFieldError(err error, field string) error {
+	return fieldError(err, field)
+}
+
+// GenIndexError names the list element an error is about, for GenFieldError to put the field in front of.
+func GenIndexError(err error, i int) error {
+	return fieldError(err, indexPath("", i))
+}
+
+// GenRequiredError is for required fields that weren't in the data.
+func GenRequiredError(field string) error {
+	return GenFieldError(errors.New("required field missing"), field)
+}
+
+// GenCheckType errors if an incoming item isn't the data type the field wants.
+func GenCheckType(dataType int, want int) error {
+	if dataType != want {
+		return errors.New("struct field b3 type mismatch vs incoming data type")
+	}
+	return nil
+}
+
+// GenCheckKey is for dict items that didn't match a field. Those are skipped, but only int and string keys
+// are allowed.
+func GenCheckKey(key interface{}) error {
+	switch key.(type) {
+	case int, string:
+		return nil
+	}
+	return errors.New("only int and string keys supported")
+}
+
+// GenCheckListKey errors if a list item has a key.
+func GenCheckListKey(key interface{}) error {
+	if key != nil {
+		return errors.Errorf("list item has a key (%v)", key)
+	}
+	return nil
+}
+
+// GenItemData slices an item's data off the front of buf, which starts just after its header.
+func GenItemData(buf []byte, hdr ItemHeader) ([]byte, error) {
+	if hdr.DataLen > len(buf) {
+		return nil, errors.New("item data len > buffer")
+	}
+	return buf[:hdr.DataLen], nil
+}
+
+// GenDecode checks an item's data type and decodes its data with the codec. Nulls decode as the zero value.
+func GenDecode(hdr ItemHeader, data []byte, want int, decode B3DecodeFunc) (interface{}, error) {
+	if err := GenCheckType(hdr.DataType, want); err != nil {
+		return nil, err
+	}
+	if hdr.IsNull {
+		data = []byte{}
+	}
+	value, err := decode(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "b3 type decoder fail")
+	}
+	return value, nil
+}
+
+// GenEncodeInt encodes a signed field as an integer data type. Zero is the compact zero-value, no data.
+func GenEncodeInt(dataType int, n int64) ([]byte, error) {
+	return GenAppendInt(nil, dataType, n)
+}
+
+// GenAppendInt is GenEncodeInt appending to dst. On error dst comes back as it was.
+func GenAppendInt(dst []byte, dataType int, n int64) ([]byte, error) {
+	switch {
+	case n == 0:
+		return dst, nil
+	case dataType == B3_UVARINT && n < 0:
+		return dst, errors.Errorf("value %d is negative, UVARINT is unsigned", n)
+	case dataType == B3_UVARINT:
+		return AppendUvarint64(dst, uint64(n)), nil
+	case dataType == B3_SVARINT:
+		return AppendSvarint64(dst, n), nil
+	}
+	return AppendInt64(dst, n), nil
+}
+
+// GenEncodeUint encodes an unsigned field as an integer data type. Zero is the compact zero-value, no data.
+func GenEncodeUint(dataType int, n uint64) ([]byte, error) {
+	return GenAppendUint(nil, dataType, n)
+}
+
+// GenAppendUint is GenEncodeUint appending to dst. On error dst comes back as it was.
+func GenAppendUint(dst []byte, dataType int, n uint64) ([]byte, error) {
+	switch {
+	case n == 0:
+		return dst, nil
+	case dataType == B3_UVARINT:
+		return AppendUvarint64(dst, n), nil
+	case n > math.MaxInt64:
+		name := "INT64"
+		if dataType == B3_SVARINT {
+			name = "SVARINT"
+		}
+		return dst, errors.Errorf("value %d overflows %s", n, name)
+	case dataType == B3_SVARINT:
+		return AppendSvarint64(dst, int64(n)), nil
+	}
+	return AppendInt64(dst, int64(n)), nil
+}
+
+// GenInt narrows a decoded integer for a signed field of the given bits (0 for int).
+func GenInt(decoded interface{}, bits int) (int64, error) {
+	var n int64
+	switch v := decoded.(type) {
+	case int:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, genOverflowError(v, "int", bits)
+		}
+		n = int64(v)
+	case *big.Int:
+		if !v.IsInt64() {
+			return 0, genOverflowError(v, "int", bits)
+		}
+		n = v.Int64()
+	default:
+		return 0, errors.Errorf("cannot set int field from decoded %T", decoded)
+	}
+	if size := intBits(bits); size < 64 && (n < -1<<(size-1) || n > 1<<(size-1)-1) {
+		return 0, genOverflowError(decoded, "int", bits)
+	}
+	return n, nil
+}
+
+// GenUint narrows a decoded integer for an unsigned field of the given bits (0 for uint).
+func GenUint(decoded interface{}, bits int) (uint64, error) {
+	var n uint64
+	switch v := decoded.(type) {
+	case int:
+		if v < 0 {
+			return 0, genOverflowError(v, "uint", bits)
+		}
+		n = uint64(v)
+	case int64:
+		if v < 0 {
+			return 0, genOverflowError(v, "uint", bits)
+		}
+		n = uint64(v)
+	case uint64:
+		n = v
+	case *big.Int:
+		if !v.IsUint64() {
+			return 0, genOverflowError(v, "uint", bits)
+		}
+		n = v.Uint64()
+	default:
+		return 0, errors.Errorf("cannot set uint field from decoded %T", decoded)
+	}
+	if size := intBits(bits); size < 64 && n > 1<<size-1 {
+		return 0, genOverflowError(decoded, "uint", bits)
+	}
+	return n, nil
+}
+
+// GenFloat narrows a decoded FLOAT64 for a float32 or float64 field.
+func GenFloat(decoded interface{}, bits int) (float64, error) {
+	f, ok := decoded.(float64)
+	if !ok {
+		return 0, errors.Errorf("cannot set float field from decoded %T", decoded)
+	}
+	if bits == 32 && overflowFloat32(f) {
+		return 0, genOverflowError(f, "float", bits)
+	}
+	return f, nil
+}
+
+// GenComplex narrows a decoded COMPLEX for a complex64 or complex128 field.
+func GenComplex(decoded interface{}, bits int) (complex128, error) {
+	c, ok := decoded.(complex128)
+	if !ok {
+		return 0, errors.Errorf("cannot set complex field from decoded %T", decoded)
+	}
+	if bits == 64 && (overflowFloat32(real(c)) || overflowFloat32(imag(c))) {
+		return 0, genOverflowError(c, "complex", bits)
+	}
+	return c, nil
+}
+
+// GenMarshal is marshalField for a B3Marshaler field.
+func GenMarshal(m B3Marshaler) (dataType int, data []byte, isNull bool, err error) {
+	dataType, data, err = m.MarshalB3()
+	if _, ok := m.(B3Generated); ok && err != nil {
+		return 0, nil, false, err // its errors already say which field
+	}
+	if err != nil {
+		return 0, nil, false, errors.Wrap(err, "MarshalB3 fail")
+	}
+	if dataType < 0 {
+		return 0, nil, false, errors.New("MarshalB3 returned -ve data type")
+	}
+	if n, ok := m.(B3Nullable); ok {
+		isNull = n.IsNullB3()
+	}
+	return dataType, data, isNull, nil
+}
+
+// GenAppend is GenMarshal appending the data to dst, with AppendB3 for the types that have it.
+func GenAppend(dst []byte, m B3Marshaler) (out []byte, dataType int, isNull bool, err error) {
+	if a, ok := m.(B3Appender); ok {
+		if _, ok := m.(B3Generated); ok {
+			out, err = a.AppendB3(dst)
+			return out, B3_COMPOSITE_DICT, false, err // its errors already say which field
+		}
+	}
+	dataType, data, isNull, err := GenMarshal(m)
+	if err != nil {
+		return dst, 0, false, err
+	}
+	return append(dst, data...), dataType, isNull, nil
+}
+
+// GenInsertHeader puts the item header in front of the item's data, which is dst[start:], the same as the
+// reflect path does. hdr.DataLen is set from the data.
+func GenInsertHeader(dst []byte, start int, hdr ItemHeader) ([]byte, error) {
+	return insertHeader(dst, start, hdr)
+}
+
+// GenUnmarshal is unmarshalField for a B3Unmarshaler field. The caller does nulls.
+func GenUnmarshal(u B3Unmarshaler, hdr ItemHeader, data []byte) error {
+	if _, ok := u.(B3Generated); ok {
+		return u.UnmarshalB3(hdr.DataType, data) // its errors already say which field
+	}
+	return errors.Wrap(u.UnmarshalB3(hdr.DataType, data), "UnmarshalB3 fail")
+}
+
+// GenNullDataType is the data type for the null item of a nil pointer to a marshaler, see nullDataType.
+// dataType is from the field's b3.type, 0 if it hasn't got one.
+func GenNullDataType(ptr interface{}, dataType int) int {
+	if _, ok := ptr.(B3Generated); ok {
+		return B3_COMPOSITE_DICT
+	}
+	return dataType
+}
+
+func intBits(bits int) int {
+	if bits == 0 {
+		return strconv.IntSize
+	}
+	return bits
+}
+
+func overflowFloat32(f float64) bool {
+	if f < 0 {
+		f = -f
+	}
+	return math.MaxFloat32 < f && f <= math.MaxFloat64
+}
+
+func genOverflowError(value interface{}, kind string, bits int) error {
+	if bits == 0 {
+		return errors.Errorf("value %v overflows %s field", value, kind)
+	}
+	return errors.Errorf("value %v overflows %s%d field", value, kind, bits)
+}
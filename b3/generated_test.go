@@ -0,0 +1,258 @@
+package b3_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oddy/b3-go/b3"
+	"github.com/stretchr/testify/assert"
+)
+
+// The methods for these are in genorder_b3_test.go, made by cmd/b3gen.
+
+//go:generate go run ../cmd/b3gen -type genOrder,genLine
+
+type genOrder struct {
+	ID       uint64        `b3:"1"`
+	Customer string        `b3.tag:"2" b3.key:"customer"`
+	Placed   time.Time     `b3:"3"`
+	Lines    []genLine     `b3:"4"`
+	Ship     *genLine      `b3:"5"`
+	Note     *string       `b3:"6,,omitempty"`
+	Total    b3.Decimal    `b3:"7"`
+	Status   b3.NullString `b3:"8"`
+	Due      *time.Time    `b3:"9,sched,nullzero"`
+	Gift     *genLine      `b3:"10"`
+	Tags     []string      `b3:",,key=tags"`
+	Codes    []*int32      `b3:",int64,key=codes"`
+	Ignored  string
+}
+
+type genLine struct {
+	SKU    string    `b3:"1,,required,key=sku"`
+	Qty    int16     `b3:"2,uvarint"`
+	Price  float32   `b3:"3"`
+	Weight genWeight `b3:"4"`
+	Data   []byte    `b3:"5"`
+	Deltas []int     `b3:"6"`
+	Z      complex64 `b3:"7"`
+	Matrix [][]int8  `b3:"8"`
+	Live   bool      `b3:"9"`
+}
+
+type genWeight uint8
+
+// Same fields, no methods, so these go the reflect way.
+type plainOrder genOrder
+type plainLine genLine
+
+func testOrder() genOrder {
+	note := "leave at door"
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	code := int32(-7)
+	return genOrder{
+		ID:       12345,
+		Customer: "Bob",
+		Placed:   time.Unix(1600000000, 0).UTC(),
+		Lines: []genLine{
+			{SKU: "A1", Qty: 3, Price: 1.5, Weight: 200, Data: []byte{1, 2}, Deltas: []int{-1, 0, 1}, Live: true},
+			{SKU: "B2", Z: complex(1, -2), Matrix: [][]int8{{1, 2}, {}, {-3}}},
+		},
+		Ship:   &genLine{SKU: "S"},
+		Note:   &note,
+		Total:  b3.NewDecimal(big.NewInt(1999), -2),
+		Status: b3.NullString{String: "paid", Valid: true},
+		Due:    &due,
+		Tags:   []string{"x", "", "y"},
+		Codes:  []*int32{&code, nil},
+	}
+}
+
+func TestGeneratedMatchesReflect(t *testing.T) {
+	for _, order := range []genOrder{testOrder(), {}} {
+		_, genBuf, err := order.MarshalB3()
+		assert.Nil(t, err)
+		plainBuf, err := b3.StructToBuf(plainOrder(order))
+		assert.Nil(t, err)
+		assert.Equal(t, plainBuf, genBuf)
+
+		// StructToBuf uses the generated methods
+		buf, err := b3.StructToBuf(order)
+		assert.Nil(t, err)
+		assert.Equal(t, genBuf, buf)
+
+		for _, line := range order.Lines {
+			_, genBuf, err := line.MarshalB3()
+			assert.Nil(t, err)
+			plainBuf, err := b3.StructToBuf(plainLine(line))
+			assert.Nil(t, err)
+			assert.Equal(t, plainBuf, genBuf)
+		}
+	}
+
+	line := genLine{SKU: "A", Qty: 2, Deltas: []int{-1}}
+	_, buf, err := line.MarshalB3()
+	assert.Nil(t, err)
+	assert.Equal(t, b3.SBytes("54 01 01 41 57 02 01 02 19 03 17 04 13 05 52 06 03 48 01 01 1d 07 12 08 15 09"), buf)
+}
+
+// AppendB3 appends into the caller's buffer, so reusing one allocates less than the reflect way, not more.
+func TestGeneratedAppend(t *testing.T) {
+	order := testOrder()
+	_, want, err := order.MarshalB3()
+	assert.Nil(t, err)
+	buf, err := order.AppendB3(b3.SBytes("ff"))
+	assert.Nil(t, err)
+	assert.Equal(t, append(b3.SBytes("ff"), want...), buf)
+
+	buf, err = b3.AppendStruct(buf[:0], &order)
+	assert.Nil(t, err)
+	genAllocs := testing.AllocsPerRun(100, func() {
+		buf, err = b3.AppendStruct(buf[:0], &order)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, want, buf)
+
+	plain := plainOrder(order)
+	plainAllocs := testing.AllocsPerRun(100, func() {
+		buf, err = b3.AppendStruct(buf[:0], &plain)
+	})
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, genAllocs, plainAllocs)
+
+	// and on error dst is as it was
+	order.Lines[1].Qty = -1
+	buf, err = order.AppendB3(b3.SBytes("ff"))
+	assert.EqualError(t, err, "struct field Lines[1].Qty: value -1 is negative, UVARINT is unsigned")
+	assert.Equal(t, b3.SBytes("ff"), buf)
+}
+
+func BenchmarkGeneratedAppend(b *testing.B) {
+	order := testOrder()
+	buf, _ := b3.AppendStruct(nil, &order)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = b3.AppendStruct(buf[:0], &order)
+	}
+}
+
+func BenchmarkReflectAppend(b *testing.B) {
+	order := plainOrder(testOrder())
+	buf, _ := b3.AppendStruct(nil, &order)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = b3.AppendStruct(buf[:0], &order)
+	}
+}
+
+func TestGeneratedRoundTrip(t *testing.T) {
+	order := testOrder()
+	buf, err := b3.StructToBuf(order)
+	assert.Nil(t, err)
+
+	gen := genOrder{}
+	assert.Nil(t, b3.BufToStruct(buf, len(buf), &gen)) // generated
+	plain := plainOrder{}
+	assert.Nil(t, b3.BufToStruct(buf, len(buf), &plain)) // reflect
+	assert.Equal(t, plainOrder(gen), plain)
+
+	assert.Equal(t, order.ID, gen.ID)
+	assert.Equal(t, order.Customer, gen.Customer)
+	assert.True(t, order.Placed.Equal(gen.Placed))
+	assert.Equal(t, 2, len(gen.Lines))
+	assert.Equal(t, order.Lines[0].Deltas, gen.Lines[0].Deltas)
+	assert.Equal(t, order.Lines[1].Matrix[2], gen.Lines[1].Matrix[2])
+	assert.Equal(t, "S", gen.Ship.SKU)
+	assert.Equal(t, order.Note, gen.Note)
+	assert.Equal(t, "19.99", gen.Total.String())
+	assert.Equal(t, order.Status, gen.Status)
+	assert.True(t, order.Due.Equal(*gen.Due))
+	assert.Nil(t, gen.Gift)
+	assert.Equal(t, order.Tags, gen.Tags)
+	assert.Equal(t, int32(-7), *gen.Codes[0])
+	assert.Nil(t, gen.Codes[1])
+
+	// nulls
+	gen = genOrder{Due: nil}
+	_, buf, err = gen.MarshalB3()
+	assert.Nil(t, err)
+	gen.Ship = &genLine{SKU: "old"}
+	assert.Nil(t, gen.UnmarshalB3(b3.B3_COMPOSITE_DICT, buf))
+	assert.Nil(t, gen.Ship)
+	assert.NotNil(t, gen.Due) // nullzero
+}
+
+func TestGeneratedOptions(t *testing.T) {
+	// Only the reflect path does options, nested generated structs included.
+	order := testOrder()
+	opts := b3.EncodeOptions{KeyStyle: b3.StringKeys, OmitEmpty: true}
+	buf, err := b3.StructToBufOptions(order, opts)
+	assert.Nil(t, err)
+	plainBuf, err := b3.StructToBufOptions(plainOrder(order), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, plainBuf, buf)
+	_, genBuf, err := order.MarshalB3()
+	assert.Nil(t, err)
+	assert.NotEqual(t, genBuf, buf)
+
+	gen := genOrder{}
+	assert.Nil(t, b3.BufToStruct(buf, len(buf), &gen))
+	assert.Equal(t, order.Customer, gen.Customer)
+	assert.Equal(t, "A1", gen.Lines[0].SKU)
+
+	// and decoding with a Tracer, which the generated code can't call.
+	out := strings.Builder{}
+	gen = genOrder{}
+	assert.Nil(t, b3.UnmarshalOptions(buf, &gen, b3.DecodeOptions{Tracer: b3.WriterTracer{W: &out}}))
+	assert.Equal(t, "A1", gen.Lines[0].SKU)
+	assert.Contains(t, out.String(), "b3: Lines[0].SKU: set from data type 4, 2 bytes\n")
+	out.Reset()
+	gen = genOrder{}
+	assert.Nil(t, b3.BufToStructOptions(buf, len(buf), &gen, b3.DecodeOptions{Tracer: b3.WriterTracer{W: &out}}))
+	assert.Equal(t, "A1", gen.Lines[0].SKU)
+	assert.Contains(t, out.String(), "b3: Lines[0].SKU: set from data type 4, 2 bytes\n")
+}
+
+func TestGeneratedErrors(t *testing.T) {
+	line := genLine{}
+	err := line.UnmarshalB3(b3.B3_COMPOSITE_DICT, b3.SBytes("17 02"))
+	assert.EqualError(t, err, "struct field SKU: required field missing")
+
+	err = line.UnmarshalB3(b3.B3_COMPOSITE_DICT, b3.SBytes("54 01 01 41 57 02 03 ff ff 03"))
+	assert.EqualError(t, err, "struct field Qty: value 65535 overflows int16 field")
+
+	err = line.UnmarshalB3(b3.B3_COMPOSITE_DICT, b3.SBytes("54 01 01 41 58 02 01 02"))
+	assert.EqualError(t, err, "struct field Qty: struct field b3 type mismatch vs incoming data type")
+
+	err = line.UnmarshalB3(b3.B3_COMPOSITE_LIST, nil)
+	assert.EqualError(t, err, "struct field b3 type mismatch vs incoming data type")
+
+	err = line.UnmarshalB3(b3.B3_COMPOSITE_DICT, b3.SBytes("34 01 78"))
+	assert.EqualError(t, err, "only int and string keys supported")
+
+	// the same paths as the reflect way, list index and all
+	order := genOrder{Lines: []genLine{{SKU: "x"}, {SKU: "y", Qty: -1}}}
+	_, _, err = order.MarshalB3()
+	assert.EqualError(t, err, "struct field Lines[1].Qty: value -1 is negative, UVARINT is unsigned")
+	_, plainErr := b3.StructToBuf(plainOrder(order))
+	assert.Equal(t, err.Error(), plainErr.Error())
+	_, plainErr = b3.StructToBufOptions(plainOrder(order), b3.EncodeOptions{OmitEmpty: true}) // not generated
+	assert.Equal(t, err.Error(), plainErr.Error())
+
+	buf, err := b3.PackDict(map[int]interface{}{4: []interface{}{map[string]interface{}{"sku": "x"}, map[int]interface{}{}}})
+	assert.Nil(t, err)
+	order = genOrder{}
+	err = order.UnmarshalB3(b3.B3_COMPOSITE_DICT, buf)
+	assert.EqualError(t, err, "struct field Lines[1].SKU: required field missing")
+	plainErr = b3.BufToStruct(buf, len(buf), &plainOrder{})
+	assert.Equal(t, err.Error(), plainErr.Error())
+
+	buf, err = b3.PackDict(map[string]interface{}{"codes": []interface{}{nil, "x"}})
+	assert.Nil(t, err)
+	err = order.UnmarshalB3(b3.B3_COMPOSITE_DICT, buf)
+	assert.EqualError(t, err, "struct field Codes[1]: struct field b3 type mismatch vs incoming data type")
+	plainErr = b3.BufToStruct(buf, len(buf), &plainOrder{})
+	assert.Equal(t, err.Error(), plainErr.Error())
+}
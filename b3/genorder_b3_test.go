@@ -0,0 +1,689 @@
+// Code generated by b3gen. DO NOT EDIT.
+
+package b3_test
+
+import (
+	"time"
+
+	"github.com/oddy/b3-go/b3"
+)
+
+// AppendB3 appends a genOrder's CompositeDict data to dst, the same as b3.AppendStruct does.
+func (v genOrder) AppendB3(dst []byte) ([]byte, error) {
+	orig := len(dst) // dst goes back as it was on errors
+	var dt, start int
+	var isNull bool
+	var err error
+
+	start = len(dst)
+	dt, isNull = b3.B3_UVARINT, false
+	if dst, err = b3.GenAppendUint(dst, b3.B3_UVARINT, v.ID); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "ID")
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 1, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "ID")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_UTF8, false
+	dst = b3.AppendUtf8(dst, v.Customer)
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 2, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Customer")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_STAMP64, false
+	if dst, err = b3.AppendStamp64(dst, v.Placed); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Placed")
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 3, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Placed")
+	}
+
+	start = len(dst)
+	for i1 := range v.Lines {
+		start1 := len(dst)
+		if dst, dt, isNull, err = b3.GenAppend(dst, &v.Lines[i1]); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i1), "Lines")
+		}
+		if dst, err = b3.GenInsertHeader(dst, start1, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i1), "Lines")
+		}
+	}
+	dt, isNull = b3.B3_COMPOSITE_LIST, false
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 4, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Lines")
+	}
+
+	start = len(dst)
+	if v.Ship == nil {
+		dt, isNull = b3.GenNullDataType(v.Ship, 0), true
+	} else {
+		if dst, dt, isNull, err = b3.GenAppend(dst, v.Ship); err != nil {
+			return dst[:orig], b3.GenFieldError(err, "Ship")
+		}
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 5, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Ship")
+	}
+
+	if v.Note != nil {
+		start = len(dst)
+		dt, isNull = b3.B3_UTF8, false
+		dst = b3.AppendUtf8(dst, *v.Note)
+		if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 6, IsNull: isNull}); err != nil {
+			return dst[:orig], b3.GenFieldError(err, "Note")
+		}
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_DECIMAL, false
+	dst = b3.AppendDecimal(dst, v.Total)
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 7, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Total")
+	}
+
+	start = len(dst)
+	if dst, dt, isNull, err = b3.GenAppend(dst, &v.Status); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Status")
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 8, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Status")
+	}
+
+	start = len(dst)
+	if v.Due == nil {
+		dt, isNull = b3.B3_SCHED, false
+		dst = b3.AppendSched(dst, *new(time.Time))
+	} else {
+		dt, isNull = b3.B3_SCHED, false
+		dst = b3.AppendSched(dst, *v.Due)
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 9, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Due")
+	}
+
+	start = len(dst)
+	if v.Gift == nil {
+		dt, isNull = b3.GenNullDataType(v.Gift, 0), true
+	} else {
+		if dst, dt, isNull, err = b3.GenAppend(dst, v.Gift); err != nil {
+			return dst[:orig], b3.GenFieldError(err, "Gift")
+		}
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 10, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Gift")
+	}
+
+	start = len(dst)
+	for i2 := range v.Codes {
+		start2 := len(dst)
+		if v.Codes[i2] == nil {
+			dt, isNull = b3.B3_INT64, true
+		} else {
+			dt, isNull = b3.B3_INT64, false
+			if dst, err = b3.GenAppendInt(dst, b3.B3_INT64, int64(*v.Codes[i2])); err != nil {
+				return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i2), "Codes")
+			}
+		}
+		if dst, err = b3.GenInsertHeader(dst, start2, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i2), "Codes")
+		}
+	}
+	dt, isNull = b3.B3_COMPOSITE_LIST, false
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: "codes", IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Codes")
+	}
+
+	start = len(dst)
+	for i3 := range v.Tags {
+		start3 := len(dst)
+		dt, isNull = b3.B3_UTF8, false
+		dst = b3.AppendUtf8(dst, v.Tags[i3])
+		if dst, err = b3.GenInsertHeader(dst, start3, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i3), "Tags")
+		}
+	}
+	dt, isNull = b3.B3_COMPOSITE_LIST, false
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: "tags", IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Tags")
+	}
+	return dst, nil
+}
+
+// MarshalB3 encodes a genOrder as CompositeDict data, the same as b3.StructToBuf does.
+func (v genOrder) MarshalB3() (int, []byte, error) {
+	data, err := v.AppendB3(make([]byte, 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	return b3.B3_COMPOSITE_DICT, data, nil
+}
+
+// UnmarshalB3 decodes CompositeDict data into a genOrder, the same as b3.BufToStruct does.
+func (v *genOrder) UnmarshalB3(dataType int, data []byte) error {
+	if err := b3.GenCheckType(dataType, b3.B3_COMPOSITE_DICT); err != nil {
+		return err
+	}
+	for index := 0; index < len(data); {
+		hdr, used, err := b3.DecodeHeader(data[index:])
+		if err != nil {
+			return err
+		}
+		index += used
+		item, err := b3.GenItemData(data[index:], hdr)
+		if err != nil {
+			return err
+		}
+		index += hdr.DataLen
+
+		switch hdr.Key {
+		case 1:
+			d, err := b3.GenDecode(hdr, item, b3.B3_UVARINT, b3.CodecDecodeUvarint)
+			if err != nil {
+				return b3.GenFieldError(err, "ID")
+			}
+			n, err := b3.GenUint(d, 64)
+			if err != nil {
+				return b3.GenFieldError(err, "ID")
+			}
+			v.ID = n
+		case 2, "customer":
+			d, err := b3.GenDecode(hdr, item, b3.B3_UTF8, b3.DecodeUtf8)
+			if err != nil {
+				return b3.GenFieldError(err, "Customer")
+			}
+			v.Customer = d.(string)
+		case 3:
+			d, err := b3.GenDecode(hdr, item, b3.B3_STAMP64, b3.DecodeStamp64)
+			if err != nil {
+				return b3.GenFieldError(err, "Placed")
+			}
+			v.Placed = d.(time.Time)
+		case 4:
+			if err := b3.GenCheckType(hdr.DataType, b3.B3_COMPOSITE_LIST); err != nil {
+				return b3.GenFieldError(err, "Lines")
+			}
+			if hdr.IsNull {
+				v.Lines = nil
+			} else {
+				var list4 []genLine
+				for index4 := 0; index4 < len(item); {
+					hdr4, used, err := b3.DecodeHeader(item[index4:])
+					if err != nil {
+						return b3.GenFieldError(err, "Lines")
+					}
+					index4 += used
+					if err := b3.GenCheckListKey(hdr4.Key); err != nil {
+						return b3.GenFieldError(err, "Lines")
+					}
+					item4, err := b3.GenItemData(item[index4:], hdr4)
+					if err != nil {
+						return b3.GenFieldError(err, "Lines")
+					}
+					index4 += hdr4.DataLen
+					var elem4 genLine
+					if hdr4.IsNull {
+						elem4 = *new(genLine)
+					} else if err := b3.GenUnmarshal(&elem4, hdr4, item4); err != nil {
+						return b3.GenFieldError(b3.GenIndexError(err, len(list4)), "Lines")
+					}
+					list4 = append(list4, elem4)
+				}
+				v.Lines = list4
+			}
+		case 5:
+			if hdr.IsNull {
+				v.Ship = nil
+			} else {
+				if v.Ship == nil {
+					v.Ship = new(genLine)
+				}
+				if hdr.IsNull {
+					*v.Ship = *new(genLine)
+				} else if err := b3.GenUnmarshal(v.Ship, hdr, item); err != nil {
+					return b3.GenFieldError(err, "Ship")
+				}
+			}
+		case 6:
+			if hdr.IsNull {
+				v.Note = nil
+			} else {
+				if v.Note == nil {
+					v.Note = new(string)
+				}
+				d, err := b3.GenDecode(hdr, item, b3.B3_UTF8, b3.DecodeUtf8)
+				if err != nil {
+					return b3.GenFieldError(err, "Note")
+				}
+				*v.Note = d.(string)
+			}
+		case 7:
+			d, err := b3.GenDecode(hdr, item, b3.B3_DECIMAL, b3.DecodeDecimal)
+			if err != nil {
+				return b3.GenFieldError(err, "Total")
+			}
+			v.Total = d.(b3.Decimal)
+		case 8:
+			if hdr.IsNull {
+				v.Status = *new(b3.NullString)
+			} else if err := b3.GenUnmarshal(&v.Status, hdr, item); err != nil {
+				return b3.GenFieldError(err, "Status")
+			}
+		case 9:
+			if hdr.IsNull {
+				v.Due = new(time.Time)
+			} else {
+				if hdr.IsNull {
+					v.Due = nil
+				} else {
+					if v.Due == nil {
+						v.Due = new(time.Time)
+					}
+					d, err := b3.GenDecode(hdr, item, b3.B3_SCHED, b3.DecodeSched)
+					if err != nil {
+						return b3.GenFieldError(err, "Due")
+					}
+					*v.Due = d.(time.Time)
+				}
+			}
+		case 10:
+			if hdr.IsNull {
+				v.Gift = nil
+			} else {
+				if v.Gift == nil {
+					v.Gift = new(genLine)
+				}
+				if hdr.IsNull {
+					*v.Gift = *new(genLine)
+				} else if err := b3.GenUnmarshal(v.Gift, hdr, item); err != nil {
+					return b3.GenFieldError(err, "Gift")
+				}
+			}
+		case "codes":
+			if err := b3.GenCheckType(hdr.DataType, b3.B3_COMPOSITE_LIST); err != nil {
+				return b3.GenFieldError(err, "Codes")
+			}
+			if hdr.IsNull {
+				v.Codes = nil
+			} else {
+				var list5 []*int32
+				for index5 := 0; index5 < len(item); {
+					hdr5, used, err := b3.DecodeHeader(item[index5:])
+					if err != nil {
+						return b3.GenFieldError(err, "Codes")
+					}
+					index5 += used
+					if err := b3.GenCheckListKey(hdr5.Key); err != nil {
+						return b3.GenFieldError(err, "Codes")
+					}
+					item5, err := b3.GenItemData(item[index5:], hdr5)
+					if err != nil {
+						return b3.GenFieldError(err, "Codes")
+					}
+					index5 += hdr5.DataLen
+					var elem5 *int32
+					if hdr5.IsNull {
+						elem5 = nil
+					} else {
+						if elem5 == nil {
+							elem5 = new(int32)
+						}
+						d, err := b3.GenDecode(hdr5, item5, b3.B3_INT64, b3.DecodeInt64)
+						if err != nil {
+							return b3.GenFieldError(b3.GenIndexError(err, len(list5)), "Codes")
+						}
+						n, err := b3.GenInt(d, 32)
+						if err != nil {
+							return b3.GenFieldError(b3.GenIndexError(err, len(list5)), "Codes")
+						}
+						*elem5 = int32(n)
+					}
+					list5 = append(list5, elem5)
+				}
+				v.Codes = list5
+			}
+		case "tags":
+			if err := b3.GenCheckType(hdr.DataType, b3.B3_COMPOSITE_LIST); err != nil {
+				return b3.GenFieldError(err, "Tags")
+			}
+			if hdr.IsNull {
+				v.Tags = nil
+			} else {
+				var list6 []string
+				for index6 := 0; index6 < len(item); {
+					hdr6, used, err := b3.DecodeHeader(item[index6:])
+					if err != nil {
+						return b3.GenFieldError(err, "Tags")
+					}
+					index6 += used
+					if err := b3.GenCheckListKey(hdr6.Key); err != nil {
+						return b3.GenFieldError(err, "Tags")
+					}
+					item6, err := b3.GenItemData(item[index6:], hdr6)
+					if err != nil {
+						return b3.GenFieldError(err, "Tags")
+					}
+					index6 += hdr6.DataLen
+					var elem6 string
+					d, err := b3.GenDecode(hdr6, item6, b3.B3_UTF8, b3.DecodeUtf8)
+					if err != nil {
+						return b3.GenFieldError(b3.GenIndexError(err, len(list6)), "Tags")
+					}
+					elem6 = d.(string)
+					list6 = append(list6, elem6)
+				}
+				v.Tags = list6
+			}
+		default: // not one of ours, skip it
+			if err := b3.GenCheckKey(hdr.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// B3Generated marks genOrder as having b3gen'd methods, see b3.B3Generated.
+func (genOrder) B3Generated() {}
+
+// AppendB3 appends a genLine's CompositeDict data to dst, the same as b3.AppendStruct does.
+func (v genLine) AppendB3(dst []byte) ([]byte, error) {
+	orig := len(dst) // dst goes back as it was on errors
+	var dt, start int
+	var isNull bool
+	var err error
+
+	start = len(dst)
+	dt, isNull = b3.B3_UTF8, false
+	dst = b3.AppendUtf8(dst, v.SKU)
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 1, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "SKU")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_UVARINT, false
+	if dst, err = b3.GenAppendInt(dst, b3.B3_UVARINT, int64(v.Qty)); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Qty")
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 2, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Qty")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_FLOAT64, false
+	dst = b3.AppendFloat64(dst, float64(v.Price))
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 3, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Price")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_UVARINT, false
+	if dst, err = b3.GenAppendUint(dst, b3.B3_UVARINT, uint64(v.Weight)); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Weight")
+	}
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 4, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Weight")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_BYTES, false
+	dst = b3.AppendBytes(dst, v.Data)
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 5, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Data")
+	}
+
+	start = len(dst)
+	for i7 := range v.Deltas {
+		start7 := len(dst)
+		dt, isNull = b3.B3_SVARINT, false
+		if dst, err = b3.GenAppendInt(dst, b3.B3_SVARINT, int64(v.Deltas[i7])); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i7), "Deltas")
+		}
+		if dst, err = b3.GenInsertHeader(dst, start7, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i7), "Deltas")
+		}
+	}
+	dt, isNull = b3.B3_COMPOSITE_LIST, false
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 6, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Deltas")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_COMPLEX, false
+	dst = b3.AppendComplex(dst, complex128(v.Z))
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 7, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Z")
+	}
+
+	start = len(dst)
+	for i8 := range v.Matrix {
+		start8 := len(dst)
+		for i9 := range v.Matrix[i8] {
+			start9 := len(dst)
+			dt, isNull = b3.B3_SVARINT, false
+			if dst, err = b3.GenAppendInt(dst, b3.B3_SVARINT, int64(v.Matrix[i8][i9])); err != nil {
+				return dst[:orig], b3.GenFieldError(b3.GenIndexError(b3.GenIndexError(err, i9), i8), "Matrix")
+			}
+			if dst, err = b3.GenInsertHeader(dst, start9, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {
+				return dst[:orig], b3.GenFieldError(b3.GenIndexError(b3.GenIndexError(err, i9), i8), "Matrix")
+			}
+		}
+		dt, isNull = b3.B3_COMPOSITE_LIST, false
+		if dst, err = b3.GenInsertHeader(dst, start8, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {
+			return dst[:orig], b3.GenFieldError(b3.GenIndexError(err, i8), "Matrix")
+		}
+	}
+	dt, isNull = b3.B3_COMPOSITE_LIST, false
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 8, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Matrix")
+	}
+
+	start = len(dst)
+	dt, isNull = b3.B3_BOOL, false
+	dst = b3.AppendBool(dst, v.Live)
+	if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: 9, IsNull: isNull}); err != nil {
+		return dst[:orig], b3.GenFieldError(err, "Live")
+	}
+	return dst, nil
+}
+
+// MarshalB3 encodes a genLine as CompositeDict data, the same as b3.StructToBuf does.
+func (v genLine) MarshalB3() (int, []byte, error) {
+	data, err := v.AppendB3(make([]byte, 0))
+	if err != nil {
+		return 0, nil, err
+	}
+	return b3.B3_COMPOSITE_DICT, data, nil
+}
+
+// UnmarshalB3 decodes CompositeDict data into a genLine, the same as b3.BufToStruct does.
+func (v *genLine) UnmarshalB3(dataType int, data []byte) error {
+	if err := b3.GenCheckType(dataType, b3.B3_COMPOSITE_DICT); err != nil {
+		return err
+	}
+	var seen [1]bool // required fields
+	for index := 0; index < len(data); {
+		hdr, used, err := b3.DecodeHeader(data[index:])
+		if err != nil {
+			return err
+		}
+		index += used
+		item, err := b3.GenItemData(data[index:], hdr)
+		if err != nil {
+			return err
+		}
+		index += hdr.DataLen
+
+		switch hdr.Key {
+		case 1, "sku":
+			seen[0] = true
+			d, err := b3.GenDecode(hdr, item, b3.B3_UTF8, b3.DecodeUtf8)
+			if err != nil {
+				return b3.GenFieldError(err, "SKU")
+			}
+			v.SKU = d.(string)
+		case 2:
+			d, err := b3.GenDecode(hdr, item, b3.B3_UVARINT, b3.CodecDecodeUvarint)
+			if err != nil {
+				return b3.GenFieldError(err, "Qty")
+			}
+			n, err := b3.GenInt(d, 16)
+			if err != nil {
+				return b3.GenFieldError(err, "Qty")
+			}
+			v.Qty = int16(n)
+		case 3:
+			d, err := b3.GenDecode(hdr, item, b3.B3_FLOAT64, b3.DecodeFloat64)
+			if err != nil {
+				return b3.GenFieldError(err, "Price")
+			}
+			f, err := b3.GenFloat(d, 32)
+			if err != nil {
+				return b3.GenFieldError(err, "Price")
+			}
+			v.Price = float32(f)
+		case 4:
+			d, err := b3.GenDecode(hdr, item, b3.B3_UVARINT, b3.CodecDecodeUvarint)
+			if err != nil {
+				return b3.GenFieldError(err, "Weight")
+			}
+			n, err := b3.GenUint(d, 8)
+			if err != nil {
+				return b3.GenFieldError(err, "Weight")
+			}
+			v.Weight = genWeight(n)
+		case 5:
+			d, err := b3.GenDecode(hdr, item, b3.B3_BYTES, b3.DecodeBytes)
+			if err != nil {
+				return b3.GenFieldError(err, "Data")
+			}
+			v.Data = d.([]byte)
+		case 6:
+			if err := b3.GenCheckType(hdr.DataType, b3.B3_COMPOSITE_LIST); err != nil {
+				return b3.GenFieldError(err, "Deltas")
+			}
+			if hdr.IsNull {
+				v.Deltas = nil
+			} else {
+				var list10 []int
+				for index10 := 0; index10 < len(item); {
+					hdr10, used, err := b3.DecodeHeader(item[index10:])
+					if err != nil {
+						return b3.GenFieldError(err, "Deltas")
+					}
+					index10 += used
+					if err := b3.GenCheckListKey(hdr10.Key); err != nil {
+						return b3.GenFieldError(err, "Deltas")
+					}
+					item10, err := b3.GenItemData(item[index10:], hdr10)
+					if err != nil {
+						return b3.GenFieldError(err, "Deltas")
+					}
+					index10 += hdr10.DataLen
+					var elem10 int
+					d, err := b3.GenDecode(hdr10, item10, b3.B3_SVARINT, b3.CodecDecodeSvarint)
+					if err != nil {
+						return b3.GenFieldError(b3.GenIndexError(err, len(list10)), "Deltas")
+					}
+					n, err := b3.GenInt(d, 0)
+					if err != nil {
+						return b3.GenFieldError(b3.GenIndexError(err, len(list10)), "Deltas")
+					}
+					elem10 = int(n)
+					list10 = append(list10, elem10)
+				}
+				v.Deltas = list10
+			}
+		case 7:
+			d, err := b3.GenDecode(hdr, item, b3.B3_COMPLEX, b3.DecodeComplex)
+			if err != nil {
+				return b3.GenFieldError(err, "Z")
+			}
+			c, err := b3.GenComplex(d, 64)
+			if err != nil {
+				return b3.GenFieldError(err, "Z")
+			}
+			v.Z = complex64(c)
+		case 8:
+			if err := b3.GenCheckType(hdr.DataType, b3.B3_COMPOSITE_LIST); err != nil {
+				return b3.GenFieldError(err, "Matrix")
+			}
+			if hdr.IsNull {
+				v.Matrix = nil
+			} else {
+				var list11 [][]int8
+				for index11 := 0; index11 < len(item); {
+					hdr11, used, err := b3.DecodeHeader(item[index11:])
+					if err != nil {
+						return b3.GenFieldError(err, "Matrix")
+					}
+					index11 += used
+					if err := b3.GenCheckListKey(hdr11.Key); err != nil {
+						return b3.GenFieldError(err, "Matrix")
+					}
+					item11, err := b3.GenItemData(item[index11:], hdr11)
+					if err != nil {
+						return b3.GenFieldError(err, "Matrix")
+					}
+					index11 += hdr11.DataLen
+					var elem11 []int8
+					if err := b3.GenCheckType(hdr11.DataType, b3.B3_COMPOSITE_LIST); err != nil {
+						return b3.GenFieldError(b3.GenIndexError(err, len(list11)), "Matrix")
+					}
+					if hdr11.IsNull {
+						elem11 = nil
+					} else {
+						var list12 []int8
+						for index12 := 0; index12 < len(item11); {
+							hdr12, used, err := b3.DecodeHeader(item11[index12:])
+							if err != nil {
+								return b3.GenFieldError(b3.GenIndexError(err, len(list11)), "Matrix")
+							}
+							index12 += used
+							if err := b3.GenCheckListKey(hdr12.Key); err != nil {
+								return b3.GenFieldError(b3.GenIndexError(err, len(list11)), "Matrix")
+							}
+							item12, err := b3.GenItemData(item11[index12:], hdr12)
+							if err != nil {
+								return b3.GenFieldError(b3.GenIndexError(err, len(list11)), "Matrix")
+							}
+							index12 += hdr12.DataLen
+							var elem12 int8
+							d, err := b3.GenDecode(hdr12, item12, b3.B3_SVARINT, b3.CodecDecodeSvarint)
+							if err != nil {
+								return b3.GenFieldError(b3.GenIndexError(b3.GenIndexError(err, len(list12)), len(list11)), "Matrix")
+							}
+							n, err := b3.GenInt(d, 8)
+							if err != nil {
+								return b3.GenFieldError(b3.GenIndexError(b3.GenIndexError(err, len(list12)), len(list11)), "Matrix")
+							}
+							elem12 = int8(n)
+							list12 = append(list12, elem12)
+						}
+						elem11 = list12
+					}
+					list11 = append(list11, elem11)
+				}
+				v.Matrix = list11
+			}
+		case 9:
+			d, err := b3.GenDecode(hdr, item, b3.B3_BOOL, b3.DecodeBool)
+			if err != nil {
+				return b3.GenFieldError(err, "Live")
+			}
+			v.Live = d.(bool)
+		default: // not one of ours, skip it
+			if err := b3.GenCheckKey(hdr.Key); err != nil {
+				return err
+			}
+		}
+	}
+	if !seen[0] {
+		return b3.GenRequiredError("SKU")
+	}
+	return nil
+}
+
+// B3Generated marks genLine as having b3gen'd methods, see b3.B3Generated.
+func (genLine) B3Generated() {}
@@ -1,7 +1,6 @@
 package b3
 
 import (
-	"bytes"
 	"fmt"
 	_ "go/types"
 
@@ -38,100 +37,109 @@ import (
 // Policy: returning byteslices everywhere, then return bytes.Join( [][]byte{x,y,z} , nil )
 //         Because thats how the python code does it and it will make the code very simple and straight-port.
 //         See "Journey of pain" below for how we got here.
+//         Later: that's several allocations per item, so now everything appends to the caller's buffer
+//         instead (AppendHeader, AppendUvarint64...), and the Encode functions are those appending to nothing.
 
 // Policy: Screw it, use int everywhere we can. "int" is the default type and it will mean a lot less casting.
 
 type ItemHeader struct {
 	DataType int
-	Key interface{}
-	IsNull bool
-	DataLen int		// 0 = not hasData on encode side, len forced 0 if hasData FALSE on decode side.
+	Key      interface{}
+	IsNull   bool
+	DataLen  int // 0 = not hasData on encode side, len forced 0 if hasData FALSE on decode side.
 }
 
 func EncodeHeader(hdr ItemHeader) ([]byte, error) {
-	var extDataTypeBytes []byte
-	var lenBytes []byte
+	out, err := AppendHeader(nil, hdr)
+	if err != nil {
+		return []byte{}, err
+	}
+	return out, nil
+}
+
+// AppendHeader is EncodeHeader appending to dst, see AppendUvarint64. On error dst comes back as it was.
+func AppendHeader(dst []byte, hdr ItemHeader) ([]byte, error) {
 	var cbyte byte
 
 	// --- Null & data len ---
+	hasData := false
 	if hdr.IsNull {
-		cbyte |= 0x80 								// data value is null. Note: null supercedes has-data
-	} else {
-		if hdr.DataLen > 0 {
-			cbyte |= 0x40							// has data flag on
-			lenBytes = append(lenBytes, EncodeUvarint(hdr.DataLen)...)
-		}
-	}
-	// fmt.Printf("cbyte is %02x\n",cbyte)
-
-	// --- Key type ---
-	keyTypeBits, keyBytes, err := EncodeKey(hdr.Key)
-	if err != nil {
-		return []byte{}, err
+		cbyte |= 0x80 // data value is null. Note: null supercedes has-data
+	} else if hdr.DataLen > 0 {
+		cbyte |= 0x40 // has data flag on
+		hasData = true
 	}
-	cbyte |= keyTypeBits & 0x30					// middle 2 bits for key type
-
-	// fmt.Printf("cbyte is %02x\n",cbyte)
 
 	// --- Data type ---
-	if hdr.DataType < 0 {							// Sanity S
-		return []byte{}, fmt.Errorf("-ve data types not permitted")
+	if hdr.DataType < 0 { // Sanity S
+		return dst, fmt.Errorf("-ve data types not permitted")
 	}
-
-	if hdr.DataType > 14 { 							// 'extended' data types 15 and up are a seperate uvarint
-		extDataTypeBytes = append(extDataTypeBytes, EncodeUvarint(hdr.DataType)...)
-		cbyte |= 0x0f 							// control byte data_typeck bits set to all 1's to signify this
+	if hdr.DataType > 14 { // 'extended' data types 15 and up are a seperate uvarint
+		cbyte |= 0x0f // control byte data_typeck bits set to all 1's to signify this
 	} else {
 		cbyte |= byte(hdr.DataType) & 0x0f
 	}
 
 	// --- Build header ---
-	// fmt.Printf("cbyte is %02x\n",cbyte)
-	out := bytes.Join([][]byte{ []byte{cbyte}, extDataTypeBytes, keyBytes, lenBytes  }, nil)
+	// The key type bits are only known once the key's encoded, so leave the control byte to last.
+	start := len(dst)
+	out := append(dst, cbyte)
+	if hdr.DataType > 14 {
+		out = appendUvarint(out, hdr.DataType)
+	}
+	out, keyTypeBits, err := appendKey(out, hdr.Key)
+	if err != nil {
+		return dst, err
+	}
+	out[start] |= keyTypeBits & 0x30 // middle 2 bits for key type
+	if hasData {
+		out = appendUvarint(out, hdr.DataLen)
+	}
 	return out, nil
-
 }
 
-
-
 // todo: its still slightly up in the air what index we return if there is an error.
 //       in python, decode_header exceptions are unhandled even by the composite unpackers, so it blows straight
 //       through to user code. So there's no actual answer yet, but going forward we should maintain a policy of:
 // policy: "all returns are invalid if err != nil"
 
-
-
 // Gonna do this with an interface and a typeswitch.
 // "The zero value of a slice is nil". Also there are "nil slices" and "empty slices".
 // You can cast a -ve into to a uint, you get a yuuge number. So it lets you do it and "C's you up"
 
 func EncodeKey(ikey interface{}) (byte, []byte, error) {
+	out, keyTypeBits, err := appendKey([]byte{}, ikey)
+	if err != nil {
+		return 0, []byte{}, err
+	}
+	return keyTypeBits, out, nil
+}
+
+func appendKey(dst []byte, ikey interface{}) ([]byte, byte, error) {
 
 	switch key := ikey.(type) {
 
 	case nil: // also nil slice and/or empty slice?		// does this work?
-		return 0x00, []byte{}, nil
-
+		return dst, 0x00, nil
 
 	// note:   if you e.g. "case int,uint:"  go doesn't concretize and you get interface{}
 	// policy: only accepting ints for now, prefer Simplicity over flexibility(?)
 	case int:
 		if key < 0 {
-			return 0, []byte{}, fmt.Errorf("negative int keys are not supported")
+			return dst, 0, fmt.Errorf("negative int keys are not supported")
 		}
-		return 0x10, EncodeUvarint(key), nil
+		return appendUvarint(dst, key), 0x10, nil
 
 	case string:
-		keyBytes := []byte(key) // like strings ARE utf8 bytes sooo this should be ok
-		lenBytes := EncodeUvarint(len(keyBytes))
-		return 0x20, bytes.Join([][]byte{lenBytes, keyBytes}, nil), nil
+		dst = appendUvarint(dst, len(key)) // like strings ARE utf8 bytes sooo this should be ok
+		return append(dst, key...), 0x20, nil
 
 	case []byte:
-		lenBytes := EncodeUvarint(len(key))
-		return 0x30, bytes.Join([][]byte{lenBytes, key}, nil), nil
+		dst = appendUvarint(dst, len(key))
+		return append(dst, key...), 0x30, nil
 
 	default:
-		return 0, []byte{}, fmt.Errorf("unknown key type (not nil/int/str/bytes)")
+		return dst, 0, fmt.Errorf("unknown key type (not nil/int/str/bytes)")
 	}
 }
 
@@ -146,31 +154,19 @@ func EncodeKey(ikey interface{}) (byte, []byte, error) {
 
 // Do we do a lot of error checking, or do we make a slice-function that acts like python's does?
 
-
 // the DEcoders are going to just be given slices. The bounds-checking will be done by the codec's caller.
 
-
 // "it’s idiomatic to have functions like slice = doSomethingWithSlice(slice) and less so to see doSomethingWithSlice(&slice)"
 
-
 // We don't need to pass buf and index if we're passing slices around all the time. Just pass a new slice.
 // You can see in DecodeUvarint
 
-
-
-
-
-
-
-
-
-
 // ++++ new +++++++
 
-	// ==============================================================================================
-	// We're passing slices. decode_header is special, it gets the [x:] rest-of-buf,
-	// everything else gets [x:y] because sizes are KNOWN for everything else.
-	// ==============================================================================================
+// ==============================================================================================
+// We're passing slices. decode_header is special, it gets the [x:] rest-of-buf,
+// everything else gets [x:y] because sizes are KNOWN for everything else.
+// ==============================================================================================
 
 // decode_header DOES need to return number of bytes consumed, but the size-known functions dont.
 // DECIDED.
@@ -178,29 +174,30 @@ func EncodeKey(ikey interface{}) (byte, []byte, error) {
 // Q: Do errors return 0 bytes consumed?
 // A: yes. bytesConsumed is invalid if there is an error. Return 0 for it and expect it not to be used.
 
-func DecodeKey(keyTypeBits byte, buf []byte) (interface{}, int, error) {  // Return: key-value, bytes-consumed, error
-	if keyTypeBits == 0x00 {							// no key
+func DecodeKey(keyTypeBits byte, buf []byte) (interface{}, int, error) { // Return: key-value, bytes-consumed, error
+	if keyTypeBits == 0x00 { // no key
 		return nil, 0, nil
 	}
 
-	if keyTypeBits == 0x10 {							// (u)int key
-		return DecodeUvarint(buf)		// Note also would return error
+	if keyTypeBits == 0x10 { // (u)int key
+		return DecodeUvarint(buf) // Note also would return error
 	}
 
-	if keyTypeBits == 0x20 || keyTypeBits == 0x30 {		// string or bytes key.
-		klen, nLenBytes, err := DecodeUvarint(buf)		// nLenBytes = how many bytes the uvarint len itself is.
+	if keyTypeBits == 0x20 || keyTypeBits == 0x30 { // string or bytes key.
+		klen, nLenBytes, err := DecodeUvarint(buf) // nLenBytes = how many bytes the uvarint len itself is.
 		if err != nil {
-			return nil, 0, errors.Wrap(err,"decodekey decode len uvarint")  // bytesConsumed should be 0 if error.
+			return nil, 0, errors.Wrap(err, "decodekey decode len uvarint") // bytesConsumed should be 0 if error.
 		}
 
 		// result returned from DecodeUvarint will never be negative.
 
-		end := nLenBytes + klen
-		if end >= len(buf) {
+		// a key can end right at the end of the buffer (compact zero-value items have no data len after it)
+		if klen > len(buf)-nLenBytes {
 			return nil, 0, errors.New("key size > buffer len")
 		}
+		end := nLenBytes + klen
 
-		keyBytes := buf[nLenBytes : end]
+		keyBytes := buf[nLenBytes:end]
 
 		if keyTypeBits == 0x30 {
 			return keyBytes, end, nil
@@ -213,23 +210,18 @@ func DecodeKey(keyTypeBits byte, buf []byte) (interface{}, int, error) {  // Ret
 	return nil, 0, errors.New("invalid key type in control byte")
 }
 
-
 // 							   returns: ItemHeader struct, bytesUsed int, error
 
 func DecodeHeader(buf []byte) (ItemHeader, int, error) {
 	var index, bytesUsed int
 	var err error
 
-	fmt.Println("DecodeHeader called")
-	fmt.Print(Hexdump(buf, len(buf)))
-	fmt.Println(" ")
-
 	hdr := ItemHeader{}
 	// Must be at least 1 byte
 	if len(buf) < 1 {
-		return hdr,0,errors.New("decodeheader buf empty")
+		return hdr, 0, errors.New("decodeheader buf empty")
 	}
-	cbyte := buf[0]				// control byte
+	cbyte := buf[0] // control byte
 	index += 1
 
 	// --- data type ---
@@ -237,7 +229,7 @@ func DecodeHeader(buf []byte) (ItemHeader, int, error) {
 	if hdr.DataType == 15 {
 		hdr.DataType, bytesUsed, err = DecodeUvarint(buf[index:])
 		if err != nil {
-			return hdr,0,errors.Wrap(err,"item header extended datatype decode failed")
+			return hdr, 0, errors.Wrap(err, "item header extended datatype decode failed")
 		}
 		index += bytesUsed
 	}
@@ -246,15 +238,15 @@ func DecodeHeader(buf []byte) (ItemHeader, int, error) {
 	keyTypeBits := cbyte & 0x30
 	hdr.Key, bytesUsed, err = DecodeKey(keyTypeBits, buf[index:])
 	if err != nil {
-		return hdr,0,errors.Wrap(err,"item header decode key fail")
+		return hdr, 0, errors.Wrap(err, "item header decode key fail")
 	}
 	index += bytesUsed
 
 	// --- Null check ---
-	hdr.IsNull  = (cbyte & 0x80) == 0x80
-	hasData    := (cbyte & 0x40) == 0x40
+	hdr.IsNull = (cbyte & 0x80) == 0x80
+	hasData := (cbyte & 0x40) == 0x40
 	if hdr.IsNull && hasData {
-		return hdr,0,errors.New("item header invalid state - is_null and has_data both ON")
+		return hdr, 0, errors.New("item header invalid state - is_null and has_data both ON")
 	}
 
 	// --- Data len ---
@@ -262,17 +254,14 @@ func DecodeHeader(buf []byte) (ItemHeader, int, error) {
 	if hasData {
 		hdr.DataLen, bytesUsed, err = DecodeUvarint(buf[index:])
 		if err != nil {
-			return hdr,0,errors.Wrap(err, "item header decode data len fail")
+			return hdr, 0, errors.Wrap(err, "item header decode data len fail")
 		}
 		index += bytesUsed
 	}
 
-	fmt.Println("DecodeHeader success, returning ",hdr)
-
-	return hdr,index,nil
+	return hdr, index, nil
 }
 
-
 // Remember reallocations are also copies.
 
 // ========= Journey of pain (delete this later) - aka how are we building buffers ====================
@@ -49,13 +49,13 @@ func TestHeaderNullEnc(t *testing.T) {
 func TestHeaderHasdataEnc(t *testing.T) {
 	buf, err := EncodeHeader(ItemHeader{0, nil, false, 5})
 	assert.Nil(t, err)
-	assert.Equal(t, SBytes("40 05"), buf)					// has-data on, size follows
+	assert.Equal(t, SBytes("40 05"), buf) // has-data on, size follows
 }
 
 func TestHeaderZerovalEnc(t *testing.T) {
 	buf, err := EncodeHeader(ItemHeader{0, nil, false, 0})
 	assert.Nil(t, err)
-	assert.Equal(t, SBytes("00"), buf)					// not null but no data = compact zero-value mode
+	assert.Equal(t, SBytes("00"), buf) // not null but no data = compact zero-value mode
 }
 
 // Policy: Encoder: is_null supercedes any datalen info. If null is on, data_len forced to 0, has_data forced to false.
@@ -63,7 +63,7 @@ func TestHeaderZerovalEnc(t *testing.T) {
 func TestHeaderHasdataButNullEnc(t *testing.T) {
 	buf, err := EncodeHeader(ItemHeader{0, nil, true, 5})
 	assert.Nil(t, err)
-	assert.Equal(t, SBytes("80"), buf)					// test that isNull supercedes dataLen
+	assert.Equal(t, SBytes("80"), buf) // test that isNull supercedes dataLen
 }
 
 // --- Data len ---
@@ -72,7 +72,7 @@ func TestHeaderDatalenEnc(t *testing.T) {
 	buf, err := EncodeHeader(ItemHeader{5, nil, false, 5})
 	assert.Nil(t, err)
 	assert.Equal(t, SBytes("45 05"), buf)
-	buf, err =  EncodeHeader(ItemHeader{5, nil, false, 1500})
+	buf, err = EncodeHeader(ItemHeader{5, nil, false, 1500})
 	assert.Nil(t, err)
 	assert.Equal(t, SBytes("45 dc 0b"), buf)
 }
@@ -82,15 +82,15 @@ func TestHeaderDatalenEnc(t *testing.T) {
 func TestHeaderDatatypeEnc(t *testing.T) {
 	tests := []struct {
 		dataType int
-		buf []byte
+		buf      []byte
 	}{
-		{5,   SBytes("05")},
-		{14,  SBytes("0e")},
-		{15,  SBytes("0f 0f")},
-		{16,  SBytes("0f 10")},
+		{5, SBytes("05")},
+		{14, SBytes("0e")},
+		{15, SBytes("0f 0f")},
+		{16, SBytes("0f 10")},
 		{555, SBytes("0f ab 04")},
 	}
-	for _,test := range tests {
+	for _, test := range tests {
 		buf, err := EncodeHeader(ItemHeader{test.dataType, nil, false, 0})
 		assert.Nil(t, err)
 		assert.Equal(t, test.buf, buf)
@@ -104,11 +104,11 @@ func TestHeaderKeysEnc(t *testing.T) {
 		key interface{}
 		buf []byte
 	}{
-		{nil, 			SBytes("00")},
-		{4,   			SBytes("10 04")},
-		{7777777, 		SBytes("10 f1 db da 03")},
-		{"foo",			SBytes("20 03 66 6f 6f")},
-		{"Виагра",  	SBytes("20 0c d0 92 d0 b8 d0 b0 d0 b3 d1 80 d0 b0")},
+		{nil, SBytes("00")},
+		{4, SBytes("10 04")},
+		{7777777, SBytes("10 f1 db da 03")},
+		{"foo", SBytes("20 03 66 6f 6f")},
+		{"Виагра", SBytes("20 0c d0 92 d0 b8 d0 b0 d0 b3 d1 80 d0 b0")},
 		{[]byte("foo"), SBytes("30 03 66 6f 6f")},
 	}
 	for _, test := range tests {
@@ -118,27 +118,23 @@ func TestHeaderKeysEnc(t *testing.T) {
 	}
 }
 
-
 // --- Kitchen sink ---
 
 func TestHeaderAllEnc(t *testing.T) {
 	buf, err := EncodeHeader(ItemHeader{555, "foo", false, 1500})
 	assert.Nil(t, err)
 	exBuf := SBytes("6f ab 04 03 66 6f 6f dc 0b")
-    //               --                              control: null=no  data=yes  key=1,0 (UTF8)  data_type=extended (1,1,1,1)
-    //                  -----                        ext type uvarint (555)
-    //                        --                     len of utf8 key (3 bytes)
-    //                           --------            utf8 key "foo"
-    //                                    -----      data len (1500)
-    assert.Equal(t, exBuf, buf)
+	//               --                              control: null=no  data=yes  key=1,0 (UTF8)  data_type=extended (1,1,1,1)
+	//                  -----                        ext type uvarint (555)
+	//                        --                     len of utf8 key (3 bytes)
+	//                           --------            utf8 key "foo"
+	//                                    -----      data len (1500)
+	assert.Equal(t, exBuf, buf)
 }
 
-
-
 // =====================================================================================================================
 // = Item header keys
 
-
 // t.Run enables running “subtests”, one for each table entry. These are shown separately when executing go test -v
 //
 // https://gobyexample.com/testing
@@ -150,14 +146,14 @@ func TestKeytypeEnc(t *testing.T) {
 		buf   []byte
 		err   error
 	}{
-		{nil, 			0x00, []byte{}, nil},
-		{4, 			0x10, SBytes("04"), nil},
-		{7777777, 		0x10, SBytes("f1 db da 03"), nil},
-		{"foo", 		0x20, SBytes("03 66 6f 6f"), nil},
-		{"Виагра", 		0x20, SBytes("0c d0 92 d0 b8 d0 b0 d0 b3 d1 80 d0 b0"), nil},
+		{nil, 0x00, []byte{}, nil},
+		{4, 0x10, SBytes("04"), nil},
+		{7777777, 0x10, SBytes("f1 db da 03"), nil},
+		{"foo", 0x20, SBytes("03 66 6f 6f"), nil},
+		{"Виагра", 0x20, SBytes("0c d0 92 d0 b8 d0 b0 d0 b3 d1 80 d0 b0"), nil},
 		{[]byte("foo"), 0x30, SBytes("03 66 6f 6f"), nil},
-		{-4, 			0, []byte{}, fmt.Errorf("negative int keys are not supported")},
-		{true,			0, []byte{}, fmt.Errorf("unknown key type (not nil/int/str/bytes)")},
+		{-4, 0, []byte{}, fmt.Errorf("negative int keys are not supported")},
+		{true, 0, []byte{}, fmt.Errorf("unknown key type (not nil/int/str/bytes)")},
 	}
 	for _, test := range tests {
 		kcode, buf, err := EncodeKey(test.input)
@@ -208,6 +204,20 @@ func TestKeytypeDec(t *testing.T) {
 }
 */
 
+func TestHeaderAppend(t *testing.T) {
+	dst := SBytes("ff")
+	buf, err := AppendHeader(dst, ItemHeader{DataType: 4, Key: "foo", DataLen: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("ff 64 03 66 6f 6f 05"), buf)
+	buf, err = AppendHeader(dst, ItemHeader{DataType: 300, Key: 7, IsNull: true})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("ff 9f ac 02 07"), buf)
+
+	// dst is left as it was on error
+	buf, err = AppendHeader(dst, ItemHeader{DataType: 4, Key: 1.5})
+	assert.Error(t, err)
+	assert.Equal(t, SBytes("ff"), buf)
+}
 
 // =====================================================================================================================
 // = Two different kinds of building byte buffers.
@@ -307,3 +317,13 @@ func BenchmarkAppendBuffer(b *testing.B) {
 	}
 }
 
+// a string key can end right at the end of the buffer - compact zero-value items have no data len
+func TestHeaderKeyAtEndDec(t *testing.T) {
+	hdr, used, err := DecodeHeader(SBytes("24 03 66 6f 6f"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, used)
+	assert.Equal(t, ItemHeader{4, "foo", false, 0}, hdr)
+
+	_, _, err = DecodeHeader(SBytes("24 04 66 6f 6f"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package b3
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Marshal and Unmarshal are StructToBuf and BufToStruct for any value, not just structs - structs, pointers,
+// maps, slices and scalars all go the same way they would as a struct field. Like StructToBuf the result is
+// just the item data, no header, so the other end has to know what it's getting (a struct gives exactly
+// what StructToBuf does). That also means there's no way to send a top level null.
+
+// Marshal encodes v, e.g. a struct, a map[string]int or a []time.Time.
+func Marshal(v interface{}) ([]byte, error) {
+	return DefaultRegistry.MarshalOptions(v, EncodeOptions{})
+}
+
+// MarshalOptions is Marshal with options, e.g. to use string keys.
+func MarshalOptions(v interface{}, opts EncodeOptions) ([]byte, error) {
+	return DefaultRegistry.MarshalOptions(v, opts)
+}
+
+// Unmarshal decodes data made by Marshal into what v points at.
+func Unmarshal(data []byte, v interface{}) error {
+	return DefaultRegistry.UnmarshalOptions(data, v, DecodeOptions{})
+}
+
+// UnmarshalOptions is Unmarshal with options, e.g. to zero the target first.
+func UnmarshalOptions(data []byte, v interface{}, opts DecodeOptions) error {
+	return DefaultRegistry.UnmarshalOptions(data, v, opts)
+}
+
+// Marshal is Marshal using the data types in this registry.
+func (r *Registry) Marshal(v interface{}) ([]byte, error) {
+	return r.MarshalOptions(v, EncodeOptions{})
+}
+
+// MarshalOptions is MarshalOptions using the data types in this registry.
+func (r *Registry) MarshalOptions(v interface{}, opts EncodeOptions) ([]byte, error) {
+	if v == nil {
+		return nil, errors.New("Marshal of nil")
+	}
+	buf, _, isNull, err := encoder{r, opts}.appendValue(nil, reflect.ValueOf(v), "")
+	if err != nil {
+		return nil, err
+	}
+	if isNull {
+		return nil, errors.New("Marshal of a null value, which needs an item header")
+	}
+	return buf, nil
+}
+
+// Unmarshal is Unmarshal using the data types in this registry.
+func (r *Registry) Unmarshal(data []byte, v interface{}) error {
+	return r.UnmarshalOptions(data, v, DecodeOptions{})
+}
+
+// UnmarshalOptions is UnmarshalOptions using the data types in this registry.
+func (r *Registry) UnmarshalOptions(data []byte, v interface{}, opts DecodeOptions) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return errors.New("Unmarshal needs a non-nil pointer")
+	}
+	dataType, err := r.dataTypeOf(ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+	if opts.Zero {
+		ptr.Elem().Set(reflect.Zero(ptr.Type().Elem()))
+	}
+	// there's no header, so make up the one Marshal would have had.
+	hdr := ItemHeader{DataType: dataType, DataLen: len(data)}
+	return r.decodeValue(ptr.Elem(), "", hdr, data, "", opts)
+}
+
+// The data type Marshal gives values of type t, which is the data type Unmarshal expects. Worked out from the
+// type the same way decodeValue goes, without calling any marshal methods - they might not like zero values.
+func (r *Registry) dataTypeOf(t reflect.Type) (int, error) {
+	for t.Kind() == reflect.Ptr && t != bigIntPtrType {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return 0, errors.Errorf("cannot Unmarshal into %s, use UnpackDict or UnpackList", t)
+	}
+	val := reflect.New(t).Elem() // addressable, so the pointer receiver methods count too
+	typeName := structTypeName(t)
+	methods := methodsOf(t)
+
+	switch {
+	case unmarshalable(val, methods, hasB3Unmarshaler):
+		// these check the data type themselves, and it's whatever their MarshalB3 says, which only they know.
+		if isGenerated(t) {
+			return B3_COMPOSITE_DICT, nil
+		}
+		if typer, ok := val.Addr().Interface().(B3DataTyper); ok {
+			return typer.B3DataType(), nil
+		}
+		return 0, errors.Errorf("cannot Unmarshal into %s, it needs a B3DataType method to say what data type it takes", t)
+	case typeName == "" && !isByteSlice(t) && unmarshalable(val, methods, hasBinaryUnmarshaler):
+		return B3_BYTES, nil
+	case typeName == "" && t.Kind() != reflect.String && unmarshalable(val, methods, hasTextUnmarshaler):
+		return B3_UTF8, nil
+	case isNestedStruct(t, typeName) || t.Kind() == reflect.Map:
+		return B3_COMPOSITE_DICT, nil
+	case isList(t, typeName):
+		return B3_COMPOSITE_LIST, nil
+	}
+
+	if typeName == "" {
+		typeName = inferTypeName(t)
+	}
+	dt, ok := r.LookupName(typeName)
+	if !ok {
+		return 0, errors.Errorf("cannot Unmarshal into %s, it has no b3 data type", t)
+	}
+	return dt.Number, nil
+}
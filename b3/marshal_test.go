@@ -0,0 +1,184 @@
+package b3
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalScalars(t *testing.T) {
+	buf, err := Marshal(42)
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("54"), buf)
+	n := 0
+	assert.Nil(t, Unmarshal(buf, &n))
+	assert.Equal(t, 42, n)
+
+	buf, err = Marshal("hi")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hi"), buf)
+	s := ""
+	assert.Nil(t, Unmarshal(buf, &s))
+	assert.Equal(t, "hi", s)
+
+	// zero values are no data
+	buf, err = Marshal(0.0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(buf))
+	f := 1.5
+	assert.Nil(t, Unmarshal(buf, &f))
+	assert.Equal(t, 0.0, f)
+
+	when := time.Unix(1600000000, 0).UTC()
+	buf, err = Marshal(&when)
+	assert.Nil(t, err)
+	got := time.Time{}
+	assert.Nil(t, Unmarshal(buf, &got))
+	assert.True(t, when.Equal(got))
+
+	big1 := new(big.Int).Lsh(big.NewInt(1), 70)
+	buf, err = Marshal(big1)
+	assert.Nil(t, err)
+	var gotBig *big.Int
+	assert.Nil(t, Unmarshal(buf, &gotBig))
+	assert.Equal(t, big1, gotBig)
+
+	// *big.Int with no b3.type goes as UVARINT, not as MarshalText's UTF8
+	buf, err = Marshal(big.NewInt(300))
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("ac 02"), buf)
+
+	ns := NullString{}
+	assert.Nil(t, Unmarshal([]byte("x"), &ns))
+	assert.Equal(t, NullString{String: "x", Valid: true}, ns)
+}
+
+func TestMarshalComposites(t *testing.T) {
+	buf, err := Marshal([]int{1, -1})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("48 01 02 48 01 01"), buf)
+	list := []int{}
+	assert.Nil(t, Unmarshal(buf, &list))
+	assert.Equal(t, []int{1, -1}, list)
+
+	m := map[string]interface{}{"a": 1, "b": []interface{}{"x", true}, "c": nil}
+	buf, err = Marshal(m)
+	assert.Nil(t, err)
+	dyn, err := PackDict(map[interface{}]interface{}{"a": 1, "b": []interface{}{"x", true}, "c": nil})
+	assert.Nil(t, err)
+	assert.Equal(t, dyn, buf)
+	got := map[string]interface{}{}
+	assert.Nil(t, Unmarshal(buf, &got))
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": []interface{}{"x", true}, "c": nil}, got)
+
+	counts := map[int]uint{}
+	assert.Nil(t, Unmarshal(SBytes("57 01 01 05"), &counts)) // key 1, UVARINT 5
+	assert.Equal(t, map[int]uint{1: 5}, counts)
+
+	// structs are what StructToBuf does, pointers or not
+	src := basicTypesStruct{true, -1, 1.5, complex(1, 2), "foo"}
+	want, err := StructToBuf(src)
+	assert.Nil(t, err)
+	buf, err = Marshal(&src)
+	assert.Nil(t, err)
+	assert.Equal(t, want, buf)
+	var dst *basicTypesStruct
+	assert.Nil(t, Unmarshal(buf, &dst))
+	assert.Equal(t, src, *dst)
+}
+
+func TestMarshalOptions(t *testing.T) {
+	type item struct {
+		Name string `b3:"1,,key=name"`
+		Qty  int    `b3:"2,,key=qty"`
+	}
+	items := []item{{"a", 1}, {"", 0}}
+	buf, err := MarshalOptions(items, EncodeOptions{KeyStyle: StringKeys, OmitEmpty: true})
+	assert.Nil(t, err)
+	dyn, err := UnpackList(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{map[interface{}]interface{}{"name": "a", "qty": 1}, map[interface{}]interface{}{}}, dyn)
+
+	// without Zero, fields that aren't in the data keep what they had
+	dst := item{"old", 9}
+	assert.Nil(t, Unmarshal(SBytes("58 02 01 06"), &dst))
+	assert.Equal(t, item{"old", 3}, dst)
+	assert.Nil(t, UnmarshalOptions(SBytes("58 02 01 06"), &dst, DecodeOptions{Zero: true}))
+	assert.Equal(t, item{"", 3}, dst)
+
+	// Strict errors on keys that aren't a field's, rather than skipping them
+	extra := SBytes("58 02 01 06 58 03 01 02")
+	assert.Nil(t, Unmarshal(extra, &dst))
+	err = UnmarshalOptions(extra, &dst, DecodeOptions{Strict: true})
+	assert.EqualError(t, err, "no struct field for item key 3")
+	nested := []item{}
+	err = UnmarshalOptions(SBytes("41 08 58 02 01 06 58 03 01 02"), &nested, DecodeOptions{Strict: true})
+	assert.EqualError(t, err, "struct field [0]: no struct field for item key 3")
+}
+
+func TestMarshalErrors(t *testing.T) {
+	_, err := Marshal(nil)
+	assert.EqualError(t, err, "Marshal of nil")
+	_, err = Marshal((*int)(nil))
+	assert.EqualError(t, err, "Marshal of a null value, which needs an item header")
+	_, err = Marshal(NullString{})
+	assert.EqualError(t, err, "Marshal of a null value, which needs an item header")
+	_, err = Marshal(make(chan int))
+	assert.EqualError(t, err, "struct b3.type is invalid")
+
+	n := 0
+	assert.EqualError(t, Unmarshal(nil, n), "Unmarshal needs a non-nil pointer")
+	assert.EqualError(t, Unmarshal(nil, (*int)(nil)), "Unmarshal needs a non-nil pointer")
+	var any interface{}
+	assert.EqualError(t, Unmarshal(nil, &any), "cannot Unmarshal into interface {}, use UnpackDict or UnpackList")
+	assert.EqualError(t, Unmarshal(SBytes("ff"), &n), "b3 type decoder fail: uvarint > buffer")
+
+	list := []int8{}
+	err = Unmarshal(SBytes("48 02 80 02"), &list)
+	assert.EqualError(t, err, "struct field [0]: value 128 overflows int8 field")
+}
+
+// a MarshalB3 that won't do zero values mustn't stop Unmarshal, which has no value to marshal
+type testAccount string
+
+func (a testAccount) MarshalB3() (int, []byte, error) {
+	if a == "" {
+		return 0, nil, errors.New("empty account")
+	}
+	return B3_UTF8, []byte(a), nil
+}
+
+func (a *testAccount) UnmarshalB3(dataType int, data []byte) error {
+	*a = testAccount(data)
+	return nil
+}
+
+type testAccountTyped struct{ testAccount }
+
+func (testAccountTyped) B3DataType() int { return B3_UTF8 }
+
+func TestMarshalZeroFails(t *testing.T) {
+	type holder struct {
+		Account testAccount `b3:"1"`
+		N       int         `b3:"2"`
+	}
+	buf, err := Marshal(holder{"acct", 3})
+	assert.Nil(t, err)
+	got := holder{}
+	assert.Nil(t, Unmarshal(buf, &got))
+	assert.Equal(t, holder{"acct", 3}, got)
+	viaBuf := holder{}
+	assert.Nil(t, BufToStruct(buf, len(buf), &viaBuf))
+	assert.Equal(t, got, viaBuf)
+
+	// given directly there's no header, so it has to say its data type
+	var a testAccount
+	assert.EqualError(t, Unmarshal([]byte("acct"), &a),
+		"cannot Unmarshal into b3.testAccount, it needs a B3DataType method to say what data type it takes")
+	typed := testAccountTyped{}
+	assert.Nil(t, Unmarshal([]byte("acct"), &typed))
+	assert.Equal(t, testAccount("acct"), typed.testAccount)
+}
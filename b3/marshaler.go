@@ -0,0 +1,229 @@
+package b3
+
+import (
+	"encoding"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// B3Marshaler is implemented by types that encode themselves, e.g. money, IDs, geo points.
+// MarshalB3 returns the data type number to put in the item header - one of the built-in ones, or an
+// extended type (15 and up) of your own - and the data bytes. No bytes means the compact zero-value.
+type B3Marshaler interface {
+	MarshalB3() (int, []byte, error)
+}
+
+// B3Unmarshaler is the decode side. UnmarshalB3 gets the incoming item's data type number and data bytes
+// and should return an error if it doesn't like the data type. It isn't called for null items.
+type B3Unmarshaler interface {
+	UnmarshalB3(dataType int, data []byte) error
+}
+
+// B3Nullable is implemented by B3Marshalers that can be null, like the Null* types. When IsNullB3 is true the
+// item goes as a null, with the data type from MarshalB3.
+type B3Nullable interface {
+	IsNullB3() bool
+}
+
+// B3DataTyper is implemented by B3Unmarshalers that always take the same data type, like the Null* types.
+// Unmarshal has no item header to get the data type from, so a B3Unmarshaler given to it directly (rather
+// than as a struct field) needs this to say what to pass to UnmarshalB3. b3gen'd structs don't, they're DICTs.
+type B3DataTyper interface {
+	B3DataType() int
+}
+
+// Types that only have the encoding package interfaces fall back to BYTES (BinaryMarshaler) or UTF8 (TextMarshaler),
+// but only if the field's b3.type is empty or that type. Lots of things (time.Time, big.Int) have these
+// and also a proper b3 type of their own, which must win.
+
+var (
+	b3MarshalerType       = reflect.TypeOf((*B3Marshaler)(nil)).Elem()
+	b3UnmarshalerType     = reflect.TypeOf((*B3Unmarshaler)(nil)).Elem()
+	b3NullableType        = reflect.TypeOf((*B3Nullable)(nil)).Elem()
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	textMarshalerType     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Which of these a type and its pointer implement is worked out once per type and cached (see methodsOf).
+// reflect's Implements is slow, and the encoders and decoders would otherwise ask it for every value.
+type methodSet uint16
+
+const (
+	hasB3Marshaler methodSet = 1 << iota
+	hasB3Unmarshaler
+	hasB3Nullable
+	hasB3Generated
+	hasBinaryMarshaler
+	hasBinaryUnmarshaler
+	hasTextMarshaler
+	hasTextUnmarshaler
+	hasB3Appender
+
+	hasMarshalers = hasB3Marshaler | hasB3Unmarshaler | hasBinaryMarshaler | hasBinaryUnmarshaler |
+		hasTextMarshaler | hasTextUnmarshaler
+)
+
+// In methodSet bit order.
+var methodIfaces = [...]reflect.Type{b3MarshalerType, b3UnmarshalerType, b3NullableType, b3GeneratedType,
+	binaryMarshalerType, binaryUnmarshalerType, textMarshalerType, textUnmarshalerType, b3AppenderType}
+
+type typeMethods struct {
+	value methodSet // the interfaces T implements
+	ptr   methodSet // and the ones *T does
+}
+
+// The interfaces an addressable T has, with either receiver.
+func (m typeMethods) any() methodSet {
+	return m.value | m.ptr
+}
+
+var methodCache sync.Map // reflect.Type -> typeMethods
+
+func methodsOf(t reflect.Type) typeMethods {
+	if m, ok := methodCache.Load(t); ok {
+		return m.(typeMethods)
+	}
+	var m typeMethods
+	pt := reflect.PtrTo(t)
+	for i, iface := range methodIfaces {
+		if t.Implements(iface) {
+			m.value |= 1 << i
+		}
+		if pt.Implements(iface) {
+			m.ptr |= 1 << i
+		}
+	}
+	methodCache.Store(t, m)
+	return m
+}
+
+// Encode a field with its own marshal methods if it has any. handled is false if it doesn't.
+func marshalField(fieldVal reflect.Value, typeName string) (dataType int, buf []byte, handled bool, err error) {
+	methods := methodsOf(fieldVal.Type())
+	if methods.any()&hasMarshalers == 0 {
+		return 0, nil, false, nil
+	}
+	if m, ok := marshalSource(fieldVal, methods, hasB3Marshaler); ok {
+		dataType, buf, err = m.(B3Marshaler).MarshalB3()
+		if err != nil && methods.any()&hasB3Generated != 0 {
+			return 0, nil, true, err // b3gen'd errors already say which field, and the path goes on further up
+		}
+		if err != nil {
+			return 0, nil, true, errors.Wrap(err, "MarshalB3 fail")
+		}
+		if dataType < 0 {
+			return 0, nil, true, errors.New("MarshalB3 returned -ve data type")
+		}
+		return dataType, buf, true, nil
+	}
+	if (typeName == "" || typeName == "BYTES") && !isByteSlice(fieldVal.Type()) {
+		if m, ok := marshalSource(fieldVal, methods, hasBinaryMarshaler); ok {
+			buf, err = m.(encoding.BinaryMarshaler).MarshalBinary()
+			return B3_BYTES, buf, true, errors.Wrap(err, "MarshalBinary fail")
+		}
+	}
+	if (typeName == "" || typeName == "UTF8") && fieldVal.Kind() != reflect.String {
+		if m, ok := marshalSource(fieldVal, methods, hasTextMarshaler); ok {
+			buf, err = m.(encoding.TextMarshaler).MarshalText()
+			return B3_UTF8, buf, true, errors.Wrap(err, "MarshalText fail")
+		}
+	}
+	return 0, nil, false, nil
+}
+
+// Whether a value that marshalField handled should go as a null item.
+func isNullable(fieldVal reflect.Value) bool {
+	if n, ok := marshalSource(fieldVal, methodsOf(fieldVal.Type()), hasB3Nullable); ok {
+		return n.(B3Nullable).IsNullB3()
+	}
+	return false
+}
+
+// Decode a field with its own unmarshal methods if it has any. handled is false if it doesn't.
+// Null items set the field to its zero value.
+func unmarshalField(fieldVal reflect.Value, typeName string, hdr ItemHeader, data []byte) (handled bool, err error) {
+	methods := methodsOf(fieldVal.Type())
+	if methods.any()&hasMarshalers == 0 {
+		return false, nil
+	}
+	wantType := -1 // -1 = the type checks the data type itself
+	iface := hasB3Unmarshaler
+	if !unmarshalable(fieldVal, methods, iface) {
+		switch {
+		case (typeName == "" || typeName == "BYTES") && !isByteSlice(fieldVal.Type()) && unmarshalable(fieldVal, methods, hasBinaryUnmarshaler):
+			iface, wantType = hasBinaryUnmarshaler, B3_BYTES
+		case (typeName == "" || typeName == "UTF8") && fieldVal.Kind() != reflect.String && unmarshalable(fieldVal, methods, hasTextUnmarshaler):
+			iface, wantType = hasTextUnmarshaler, B3_UTF8
+		default:
+			return false, nil
+		}
+	}
+
+	if wantType >= 0 && hdr.DataType != wantType {
+		return true, errors.New("struct field b3 type mismatch vs incoming data type")
+	}
+	if hdr.IsNull {
+		fieldVal.Set(reflect.Zero(fieldVal.Type()))
+		return true, nil
+	}
+
+	target := unmarshalTarget(fieldVal, methods, iface)
+	switch u := target.(type) {
+	case B3Unmarshaler:
+		err = u.UnmarshalB3(hdr.DataType, data)
+		if methods.any()&hasB3Generated == 0 {
+			err = errors.Wrap(err, "UnmarshalB3 fail")
+		}
+	case encoding.BinaryUnmarshaler:
+		err = errors.Wrap(u.UnmarshalBinary(data), "UnmarshalBinary fail")
+	case encoding.TextUnmarshaler:
+		err = errors.Wrap(u.UnmarshalText(data), "UnmarshalText fail")
+	}
+	return true, err
+}
+
+// The value (or a pointer to it, for pointer-receiver methods) as iface, if it implements it. methods is v's
+// type's, iface one of its bits. nil pointers don't count, there's nothing to call the method on.
+func marshalSource(v reflect.Value, methods typeMethods, iface methodSet) (interface{}, bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	if methods.value&iface != 0 {
+		return v.Interface(), true
+	}
+	if methods.ptr&iface != 0 {
+		if v.CanAddr() {
+			return v.Addr().Interface(), true
+		}
+		p := reflect.New(v.Type()) // not addressable (struct passed by value), so use a copy
+		p.Elem().Set(v)
+		return p.Interface(), true
+	}
+	return nil, false
+}
+
+func unmarshalable(v reflect.Value, methods typeMethods, iface methodSet) bool {
+	if v.Kind() == reflect.Ptr && methods.value&iface != 0 {
+		return true
+	}
+	return v.CanAddr() && methods.ptr&iface != 0
+}
+
+// Something to call the unmarshal method on, allocating pointer fields if they're nil.
+func unmarshalTarget(v reflect.Value, methods typeMethods, iface methodSet) interface{} {
+	if v.Kind() == reflect.Ptr && methods.value&iface != 0 {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return v.Interface()
+	}
+	return v.Addr().Interface()
+}
+
+func isByteSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
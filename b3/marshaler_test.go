@@ -0,0 +1,171 @@
+package b3
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// --- B3Marshaler with an extended data type, pointer receiver on the decode side ---
+
+const testMoneyType = 20
+
+type testMoney struct {
+	Cents    int
+	Currency string
+}
+
+func (m testMoney) MarshalB3() (int, []byte, error) {
+	if m == (testMoney{}) {
+		return testMoneyType, nil, nil
+	}
+	if len(m.Currency) != 3 {
+		return 0, nil, errors.New("bad currency")
+	}
+	return testMoneyType, append([]byte(m.Currency), EncodeSvarint(m.Cents)...), nil
+}
+
+func (m *testMoney) UnmarshalB3(dataType int, data []byte) error {
+	if dataType != testMoneyType {
+		return errors.New("not money")
+	}
+	if len(data) == 0 {
+		*m = testMoney{}
+		return nil
+	}
+	if len(data) < 4 {
+		return errors.New("money too short")
+	}
+	cents, _, err := DecodeSvarint(data[3:])
+	if err != nil {
+		return err
+	}
+	*m = testMoney{cents, string(data[:3])}
+	return nil
+}
+
+// --- B3Marshaler using a built-in data type ---
+
+type testGeoPoint struct{ Lat, Lon float64 }
+
+func (g testGeoPoint) MarshalB3() (int, []byte, error) {
+	buf, err := EncodeComplex(complex(g.Lat, g.Lon))
+	return B3_COMPLEX, buf, err
+}
+
+func (g *testGeoPoint) UnmarshalB3(dataType int, data []byte) error {
+	if dataType != B3_COMPLEX {
+		return errors.New("not a geo point")
+	}
+	c, err := DecodeComplex(data)
+	if err != nil {
+		return err
+	}
+	g.Lat, g.Lon = real(c.(complex128)), imag(c.(complex128))
+	return nil
+}
+
+// --- Only encoding.BinaryMarshaler ---
+
+type testID uint32
+
+func (id testID) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 4)
+	binary.BigEndian.PutUint32(out, uint32(id))
+	return out, nil
+}
+
+func (id *testID) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("id len not 4")
+	}
+	*id = testID(binary.BigEndian.Uint32(data))
+	return nil
+}
+
+type marshalerStruct struct {
+	Price testMoney     `b3.tag:"1"`
+	Where *testGeoPoint `b3.tag:"2"`
+	ID    testID        `b3.tag:"3"`
+	Addr  net.IP        `b3.tag:"4"` // TextMarshaler -> UTF8
+	Owner testID        `b3.tag:"5" b3.type:"BYTES"`
+}
+
+func TestMarshalerRoundTrip(t *testing.T) {
+	src := marshalerStruct{testMoney{-1999, "NZD"}, &testGeoPoint{-36.85, 174.76}, 0xdeadbeef, net.ParseIP("10.1.2.3"), 7}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := marshalerStruct{}
+	assert.Nil(t, BufToStruct(buf, len(buf), &dst))
+	assert.Equal(t, src.Price, dst.Price)
+	assert.Equal(t, *src.Where, *dst.Where)
+	assert.Equal(t, src.ID, dst.ID)
+	assert.Equal(t, "10.1.2.3", dst.Addr.String())
+	assert.Equal(t, src.Owner, dst.Owner)
+}
+
+func TestMarshalerBytes(t *testing.T) {
+	type moneyOnly struct {
+		Price testMoney `b3.tag:"1"`
+		ID    testID    `b3.tag:"2"`
+		Addr  net.IP    `b3.tag:"3"`
+	}
+	buf, err := StructToBuf(moneyOnly{testMoney{5, "USD"}, 0x01020304, net.ParseIP("10.1.2.3")})
+	assert.Nil(t, err)
+	//                      ext 20  key len  USD       5    BYTES key len  id           UTF8 key len  "10.1.2.3"
+	exBuf := SBytes("5f 14  01  04   55 53 44  0a   53 02 04  01 02 03 04  54 03 08  31 30 2e 31 2e 32 2e 33")
+	assert.Equal(t, exBuf, buf)
+}
+
+func TestMarshalerErrors(t *testing.T) {
+	type badMoney struct {
+		Price testMoney `b3.tag:"1"`
+	}
+	_, err := StructToBuf(badMoney{testMoney{5, "DOLLARS"}})
+	assert.EqualError(t, err, "struct field Price: MarshalB3 fail: bad currency")
+
+	// money field, but a UTF8 item turns up
+	dst := badMoney{}
+	err = BufToStruct(SBytes("54 01 03 66 6f 6f"), 0, &dst)
+	assert.EqualError(t, err, "struct field Price: UnmarshalB3 fail: not money")
+
+	// BinaryUnmarshaler field, but a UTF8 item turns up
+	dst2 := marshalerStruct{}
+	err = BufToStruct(SBytes("54 03 03 66 6f 6f"), 0, &dst2)
+	assert.EqualError(t, err, "struct field ID: struct field b3 type mismatch vs incoming data type")
+
+	// the path is put together as the error comes back, the marshaler isn't called again to find it
+	type till struct {
+		Prices map[string][]testCountedMoney `b3:"1"`
+	}
+	type shop struct {
+		Tills []till `b3:"1"`
+	}
+	calls := 0
+	src := shop{[]till{{}, {map[string][]testCountedMoney{"a": {{testMoney{5, "DOLLARS"}, &calls}}}}}}
+	_, err = Marshal(src)
+	assert.EqualError(t, err, `struct field Tills[1].Prices["a"][0]: MarshalB3 fail: bad currency`)
+	assert.Equal(t, 1, calls)
+}
+
+type testCountedMoney struct {
+	testMoney
+	calls *int
+}
+
+func (m testCountedMoney) MarshalB3() (int, []byte, error) {
+	*m.calls++
+	return m.testMoney.MarshalB3()
+}
+
+func TestMarshalerNull(t *testing.T) {
+	dst := marshalerStruct{Price: testMoney{5, "USD"}, Where: &testGeoPoint{1, 2}}
+	err := BufToStruct(SBytes("9f 14 01 9d 02"), 0, &dst) // null money, null geopoint
+	assert.Nil(t, err)
+	assert.Equal(t, testMoney{}, dst.Price)
+	assert.Nil(t, dst.Where)
+}
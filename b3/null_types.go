@@ -0,0 +1,269 @@
+package b3
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Nullable wrappers for each data type, like database/sql's NullString & co. Valid false is a null item,
+// Valid true is the value, even if it's the zero value - so "absent" and "zero" stay different without
+// needing pointer fields. They're B3Marshalers, so don't need a b3.type tag.
+
+// NullBytes is a BYTES that can be null.
+type NullBytes struct {
+	Bytes []byte
+	Valid bool
+}
+
+// NullString is a UTF8 that can be null.
+type NullString struct {
+	String string
+	Valid  bool
+}
+
+// NullBool is a BOOL that can be null.
+type NullBool struct {
+	Bool  bool
+	Valid bool
+}
+
+// NullInt64 is an INT64 that can be null.
+type NullInt64 struct {
+	Int64 int64
+	Valid bool
+}
+
+// NullUvarint is a UVARINT that can be null.
+type NullUvarint struct {
+	Uvarint uint64
+	Valid   bool
+}
+
+// NullSvarint is an SVARINT that can be null.
+type NullSvarint struct {
+	Svarint int64
+	Valid   bool
+}
+
+// NullFloat64 is a FLOAT64 that can be null.
+type NullFloat64 struct {
+	Float64 float64
+	Valid   bool
+}
+
+// NullDecimal is a DECIMAL that can be null.
+type NullDecimal struct {
+	Decimal Decimal
+	Valid   bool
+}
+
+// NullSched is a SCHED that can be null.
+type NullSched struct {
+	Time  time.Time
+	Valid bool
+}
+
+// NullStamp64 is a STAMP64 that can be null.
+type NullStamp64 struct {
+	Time  time.Time
+	Valid bool
+}
+
+// NullComplex is a COMPLEX that can be null.
+type NullComplex struct {
+	Complex complex128
+	Valid   bool
+}
+
+func (n NullBytes) IsNullB3() bool   { return !n.Valid }
+func (n NullString) IsNullB3() bool  { return !n.Valid }
+func (n NullBool) IsNullB3() bool    { return !n.Valid }
+func (n NullInt64) IsNullB3() bool   { return !n.Valid }
+func (n NullUvarint) IsNullB3() bool { return !n.Valid }
+func (n NullSvarint) IsNullB3() bool { return !n.Valid }
+func (n NullFloat64) IsNullB3() bool { return !n.Valid }
+func (n NullDecimal) IsNullB3() bool { return !n.Valid }
+func (n NullSched) IsNullB3() bool   { return !n.Valid }
+func (n NullStamp64) IsNullB3() bool { return !n.Valid }
+func (n NullComplex) IsNullB3() bool { return !n.Valid }
+
+func (NullBytes) B3DataType() int   { return B3_BYTES }
+func (NullString) B3DataType() int  { return B3_UTF8 }
+func (NullBool) B3DataType() int    { return B3_BOOL }
+func (NullInt64) B3DataType() int   { return B3_INT64 }
+func (NullUvarint) B3DataType() int { return B3_UVARINT }
+func (NullSvarint) B3DataType() int { return B3_SVARINT }
+func (NullFloat64) B3DataType() int { return B3_FLOAT64 }
+func (NullDecimal) B3DataType() int { return B3_DECIMAL }
+func (NullSched) B3DataType() int   { return B3_SCHED }
+func (NullStamp64) B3DataType() int { return B3_STAMP64 }
+func (NullComplex) B3DataType() int { return B3_COMPLEX }
+
+func (n NullBytes) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_BYTES, n.Valid, n.Bytes, EncodeBytes)
+}
+
+func (n NullString) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_UTF8, n.Valid, n.String, EncodeUtf8)
+}
+
+func (n NullBool) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_BOOL, n.Valid, n.Bool, EncodeBool)
+}
+
+func (n NullInt64) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_INT64, n.Valid, n.Int64, EncodeInt64)
+}
+
+func (n NullUvarint) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_UVARINT, n.Valid, n.Uvarint, CodecEncodeUvarint)
+}
+
+func (n NullSvarint) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_SVARINT, n.Valid, n.Svarint, CodecEncodeSvarint)
+}
+
+func (n NullFloat64) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_FLOAT64, n.Valid, n.Float64, EncodeFloat64)
+}
+
+func (n NullDecimal) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_DECIMAL, n.Valid, n.Decimal, EncodeDecimal)
+}
+
+func (n NullSched) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_SCHED, n.Valid, n.Time, EncodeSched)
+}
+
+func (n NullStamp64) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_STAMP64, n.Valid, n.Time, EncodeStamp64)
+}
+
+func (n NullComplex) MarshalB3() (int, []byte, error) {
+	return marshalNull(B3_COMPLEX, n.Valid, n.Complex, EncodeComplex)
+}
+
+func (n *NullBytes) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_BYTES, dataType, data, DecodeBytes)
+	if err == nil {
+		n.Bytes, n.Valid = append([]byte{}, v.([]byte)...), true // don't hang on to the caller's buffer
+	}
+	return err
+}
+
+func (n *NullString) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_UTF8, dataType, data, DecodeUtf8)
+	if err == nil {
+		n.String, n.Valid = v.(string), true
+	}
+	return err
+}
+
+func (n *NullBool) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_BOOL, dataType, data, DecodeBool)
+	if err == nil {
+		n.Bool, n.Valid = v.(bool), true
+	}
+	return err
+}
+
+func (n *NullInt64) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_INT64, dataType, data, DecodeInt64)
+	if err == nil {
+		n.Int64, n.Valid = v.(int64), true
+	}
+	return err
+}
+
+func (n *NullUvarint) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_UVARINT, dataType, data, CodecDecodeUvarint)
+	if err != nil {
+		return err
+	}
+	switch u := v.(type) {
+	case int:
+		n.Uvarint = uint64(u)
+	case uint64:
+		n.Uvarint = u
+	case *big.Int:
+		return errors.Errorf("value %s overflows uint64", u)
+	}
+	n.Valid = true
+	return nil
+}
+
+func (n *NullSvarint) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_SVARINT, dataType, data, decodeSvarint64)
+	if err == nil {
+		n.Svarint, n.Valid = v.(int64), true
+	}
+	return err
+}
+
+func (n *NullFloat64) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_FLOAT64, dataType, data, DecodeFloat64)
+	if err == nil {
+		n.Float64, n.Valid = v.(float64), true
+	}
+	return err
+}
+
+func (n *NullDecimal) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_DECIMAL, dataType, data, DecodeDecimal)
+	if err == nil {
+		n.Decimal, n.Valid = v.(Decimal), true
+	}
+	return err
+}
+
+func (n *NullSched) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_SCHED, dataType, data, DecodeSched)
+	if err == nil {
+		n.Time, n.Valid = v.(time.Time), true
+	}
+	return err
+}
+
+func (n *NullStamp64) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_STAMP64, dataType, data, DecodeStamp64)
+	if err == nil {
+		n.Time, n.Valid = v.(time.Time), true
+	}
+	return err
+}
+
+func (n *NullComplex) UnmarshalB3(dataType int, data []byte) error {
+	v, err := unmarshalNull(B3_COMPLEX, dataType, data, DecodeComplex)
+	if err == nil {
+		n.Complex, n.Valid = v.(complex128), true
+	}
+	return err
+}
+
+// Null items have no data, just the data type.
+func marshalNull(dataType int, valid bool, value interface{}, encode B3EncodeFunc) (int, []byte, error) {
+	if !valid {
+		return dataType, nil, nil
+	}
+	buf, err := encode(value)
+	return dataType, buf, err
+}
+
+// NullSvarint's decoder, always an int64, where CodecDecodeSvarint gives an int when it fits.
+func decodeSvarint64(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return int64(0), nil // Compact zero-value
+	}
+	n, _, err := DecodeSvarint64(buf)
+	return n, err
+}
+
+// UnmarshalB3 isn't called for null items, unmarshalField zeroes the field (so Valid goes false) instead.
+func unmarshalNull(want int, dataType int, data []byte, decode B3DecodeFunc) (interface{}, error) {
+	if dataType != want {
+		return nil, errors.Errorf("incoming data type %d, want %d", dataType, want)
+	}
+	return decode(data)
+}
@@ -0,0 +1,154 @@
+package b3
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nullsStruct struct {
+	Bytes   NullBytes   `b3.tag:"1"`
+	String  NullString  `b3.tag:"2"`
+	Bool    NullBool    `b3.tag:"3"`
+	Int64   NullInt64   `b3.tag:"4"`
+	Uvarint NullUvarint `b3.tag:"5"`
+	Svarint NullSvarint `b3.tag:"6"`
+	Float64 NullFloat64 `b3.tag:"7"`
+	Decimal NullDecimal `b3.tag:"8"`
+	Sched   NullSched   `b3.tag:"9"`
+	Stamp64 NullStamp64 `b3.tag:"10"`
+	Complex NullComplex `b3.tag:"11"`
+}
+
+func TestNullTypesNull(t *testing.T) {
+	buf, err := StructToBuf(nullsStruct{})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("93 01 94 02 95 03 96 04 97 05 98 06 99 07 9a 08 9b 09 9c 0a 9d 0b"), buf)
+
+	dst := nullsStruct{String: NullString{"old", true}, Svarint: NullSvarint{5, true}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, nullsStruct{}, dst)
+}
+
+func TestNullTypesZeroIsNotNull(t *testing.T) {
+	src := nullsStruct{
+		Bytes:   NullBytes{[]byte{}, true},
+		String:  NullString{"", true},
+		Bool:    NullBool{false, true},
+		Int64:   NullInt64{0, true},
+		Uvarint: NullUvarint{0, true},
+		Svarint: NullSvarint{0, true},
+		Float64: NullFloat64{0, true},
+		Decimal: NullDecimal{NewDecimal(big.NewInt(0), 0), true},
+		Sched:   NullSched{time.Time{}, true},
+		Stamp64: NullStamp64{time.Time{}, true},
+		Complex: NullComplex{0, true},
+	}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x13), buf[0]) // compact zero-value, not null
+
+	dst := nullsStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+func TestNullTypesRoundTrip(t *testing.T) {
+	src := nullsStruct{
+		Bytes:   NullBytes{[]byte{1, 2}, true},
+		String:  NullString{"foo", true},
+		Bool:    NullBool{true, true},
+		Int64:   NullInt64{-5, true},
+		Uvarint: NullUvarint{1 << 63, true},
+		Svarint: NullSvarint{-300, true},
+		Float64: NullFloat64{1.5, true},
+		Decimal: NullDecimal{NewDecimal(big.NewInt(12345), -2), true},
+		Sched:   NullSched{time.Date(2020, 10, 21, 1, 2, 3, 0, time.UTC), true},
+		Stamp64: NullStamp64{time.Date(2020, 10, 21, 1, 2, 3, 456, time.UTC), true},
+		Complex: NullComplex{complex(1, -1), true},
+	}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := nullsStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+}
+
+// int64s that don't fit in 32 bits, which going via int would cut down on 32 bit platforms.
+func TestNullSvarintWide(t *testing.T) {
+	for _, x := range []int64{math.MaxInt64, math.MinInt64, 1 << 40} {
+		dataType, buf, err := NullSvarint{x, true}.MarshalB3()
+		assert.Nil(t, err)
+		assert.Equal(t, B3_SVARINT, dataType)
+		assert.Equal(t, AppendSvarint64(nil, x), buf)
+		n := NullSvarint{}
+		assert.Nil(t, n.UnmarshalB3(dataType, buf))
+		assert.Equal(t, NullSvarint{x, true}, n)
+	}
+}
+
+func TestNullTypesMismatch(t *testing.T) {
+	buf, err := StructToBuf(svarintStruct{Delta: 1})
+	assert.Nil(t, err)
+	type wrongType struct {
+		Delta NullString `b3.tag:"1"`
+	}
+	err = BufToStruct(buf, len(buf), &wrongType{})
+	assert.EqualError(t, err, "struct field Delta: UnmarshalB3 fail: incoming data type 8, want 4")
+}
+
+func TestNullTypesDynamic(t *testing.T) {
+	buf, err := PackList([]interface{}{NullString{}, NullString{"a", true}})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("84 44 01 61"), buf)
+}
+
+type pointersStruct struct {
+	Count *int         `b3.tag:"1" b3.type:"SVARINT"`
+	Name  *string      `b3.tag:"2" b3.type:"UTF8"`
+	When  *time.Time   `b3.tag:"3" b3.type:"STAMP64"`
+	Inner *nestedInner `b3.tag:"4"`
+	Tags  *[]string    `b3.tag:"5" b3.type:"UTF8"`
+	Money *testMoney   `b3.tag:"6"`
+}
+
+func TestStructNilPointersAreNull(t *testing.T) {
+	buf, err := StructToBuf(pointersStruct{})
+	assert.Nil(t, err)
+	//                     svarint utf8  stamp dict  list  marshaler (type unknown)
+	assert.Equal(t, SBytes("98 01 94 02 9c 03 91 04 92 05 90 06"), buf)
+
+	zero, name := 0, ""
+	dst := pointersStruct{Count: &zero, Name: &name, Inner: &nestedInner{}}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, pointersStruct{}, dst)
+}
+
+func TestStructPointersRoundTrip(t *testing.T) {
+	zero, name, when := 0, "", time.Date(2020, 10, 21, 1, 2, 3, 0, time.UTC)
+	src := pointersStruct{&zero, &name, &when, &nestedInner{1, 2}, &[]string{"a"}, &testMoney{150, "NZD"}}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+
+	dst := pointersStruct{}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, src, dst)
+	assert.Equal(t, 0, *dst.Count) // zero, not null
+}
+
+func TestStructNullIntoNonPointer(t *testing.T) {
+	// Policy: nulls still go to zero-values for plain fields.
+	dst := svarintStruct{5, 5}
+	err := BufToStruct(SBytes("98 01 97 02"), 4, &dst)
+	assert.Nil(t, err)
+	assert.Equal(t, svarintStruct{}, dst)
+}
@@ -0,0 +1,25 @@
+package b3
+
+// KeyStyle picks which item keys StructToBufOptions uses for struct fields.
+// BufToStruct doesn't need telling, it matches int keys against b3.tag and string keys against b3.key.
+type KeyStyle int
+
+const (
+	IntKeys    KeyStyle = iota // b3.tag numbers, the default. Fields with only a b3.key use that.
+	StringKeys                 // b3.key names, for ad-hoc json-like clients. Fields with only a b3.tag use that.
+)
+
+// EncodeOptions change how structs are encoded, for StructToBufOptions and MarshalOptions.
+// The zero value is what StructToBuf and Marshal do.
+type EncodeOptions struct {
+	KeyStyle  KeyStyle
+	OmitEmpty bool // leave out all zero-valued fields, as if they were all tagged omitempty
+}
+
+// DecodeOptions change how data is decoded, for UnmarshalOptions and BufToStructOptions. The zero value is what
+// Unmarshal and BufToStruct do.
+type DecodeOptions struct {
+	Zero   bool   // zero the target first, so things that aren't in the data don't keep what they had
+	Strict bool   // items with keys that aren't a struct field's are an error, rather than skipped
+	Tracer Tracer // told what the decoding is doing, see Tracer. nil for no tracing, and no cost.
+}
@@ -0,0 +1,124 @@
+package b3
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A DataType is everything b3 needs to know about one data type - its wire number, its struct tag name,
+// and the codec functions. Numbers above 14 are 'extended' types and get their own uvarint in the item header.
+type DataType struct {
+	Number int
+	Name   string
+	Encode B3EncodeFunc
+	Decode B3DecodeFunc
+}
+
+// A Registry maps data type numbers and names to DataTypes. It is safe to use from multiple goroutines.
+// Use DefaultRegistry for normal stuff, or make your own with NewRegistry/NewDefaultRegistry to keep
+// e.g. tests from stepping on each other.
+type Registry struct {
+	mu       sync.RWMutex
+	byNumber map[int]DataType
+	byName   map[string]DataType
+	schemas  sync.Map // reflect.Type -> *structSchema, see schemaFor
+}
+
+// DefaultRegistry has the built-in types, and is what StructToBuf and BufToStruct use.
+var DefaultRegistry = NewDefaultRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{byNumber: map[int]DataType{}, byName: map[string]DataType{}}
+}
+
+// NewDefaultRegistry returns a new registry with the built-in types in it.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, dt := range builtinDataTypes {
+		if err := r.Register(dt); err != nil {
+			panic(err) // only if the builtins list is broken.
+		}
+	}
+	return r
+}
+
+// Register adds a data type. Numbers and names must not already be taken, and 0-2 are reserved - 1 and 2 are
+// DICT and LIST, which are handled before the registry is ever asked.
+func (r *Registry) Register(dt DataType) error {
+	if dt.Number < 0 {
+		return errors.New("-ve data types not permitted")
+	}
+	if dt.Number <= B3_COMPOSITE_LIST {
+		return errors.Errorf("data type number %d is reserved", dt.Number)
+	}
+	if dt.Name == "" {
+		return errors.New("data type name is empty")
+	}
+	if dt.Encode == nil || dt.Decode == nil {
+		return errors.Errorf("data type %s needs both an encoder and a decoder", dt.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.byNumber[dt.Number]; ok {
+		return errors.Errorf("data type number %d already registered as %s", dt.Number, existing.Name)
+	}
+	if existing, ok := r.byName[dt.Name]; ok {
+		return errors.Errorf("data type name %s already registered as number %d", dt.Name, existing.Number)
+	}
+	r.byNumber[dt.Number] = dt
+	r.byName[dt.Name] = dt
+	return nil
+}
+
+// Lookup finds a data type by number.
+func (r *Registry) Lookup(number int) (DataType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	dt, ok := r.byNumber[number]
+	return dt, ok
+}
+
+// LookupName finds a data type by the name used in b3.type struct tags.
+func (r *Registry) LookupName(name string) (DataType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	dt, ok := r.byName[name]
+	return dt, ok
+}
+
+// Name is the reverse lookup, number to name.
+func (r *Registry) Name(number int) (string, bool) {
+	dt, ok := r.Lookup(number)
+	return dt.Name, ok
+}
+
+// DataTypes returns everything registered, in number order.
+func (r *Registry) DataTypes() []DataType {
+	r.mu.RLock()
+	out := make([]DataType, 0, len(r.byNumber))
+	for _, dt := range r.byNumber {
+		out = append(out, dt)
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out
+}
+
+// Clone returns a copy of the registry, which can then be added to without affecting the original.
+func (r *Registry) Clone() *Registry {
+	c := NewRegistry()
+	for _, dt := range r.DataTypes() {
+		c.byNumber[dt.Number] = dt
+		c.byName[dt.Name] = dt
+	}
+	return c
+}
+
+// Register adds a data type to DefaultRegistry.
+func Register(dt DataType) error {
+	return DefaultRegistry.Register(dt)
+}
@@ -0,0 +1,168 @@
+package b3
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oddy/b3-go/internal/b3tag"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// A made-up extended data type for testing - a 3 byte RGB colour.
+type testColour struct{ R, G, B uint8 }
+
+func encodeTestColour(ifValue interface{}) ([]byte, error) {
+	c, ok := ifValue.(testColour)
+	if !ok {
+		return nil, errors.New("encodeTestColour input not testColour")
+	}
+	if c == (testColour{}) {
+		return []byte{}, nil
+	}
+	return []byte{c.R, c.G, c.B}, nil
+}
+
+func decodeTestColour(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return testColour{}, nil
+	}
+	if len(buf) != 3 {
+		return nil, errors.New("decodeTestColour data len not 3")
+	}
+	return testColour{buf[0], buf[1], buf[2]}, nil
+}
+
+var testColourType = DataType{555, "COLOUR", encodeTestColour, decodeTestColour}
+
+func TestRegistryDefault(t *testing.T) {
+	dt, ok := DefaultRegistry.Lookup(B3_UVARINT)
+	assert.True(t, ok)
+	assert.Equal(t, "UVARINT", dt.Name)
+
+	dt, ok = DefaultRegistry.LookupName("STAMP64")
+	assert.True(t, ok)
+	assert.Equal(t, B3_STAMP64, dt.Number)
+
+	name, ok := DefaultRegistry.Name(B3_SCHED)
+	assert.True(t, ok)
+	assert.Equal(t, "SCHED", name)
+
+	_, ok = DefaultRegistry.Lookup(555)
+	assert.False(t, ok)
+	assert.Equal(t, len(builtinDataTypes), len(DefaultRegistry.DataTypes()))
+}
+
+// The built-in types come from the table cmd/b3gen uses, check it names the codecs we actually register,
+// and that its classes go with the same data types fieldValueForEncode lets them.
+func TestRegistryBuiltinsTable(t *testing.T) {
+	funcName := func(fn interface{}) string {
+		name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+		return name[strings.LastIndex(name, ".")+1:]
+	}
+	assert.Equal(t, len(b3tag.Builtins), len(builtinCodecs))
+	for _, bt := range b3tag.Builtins {
+		dt, ok := DefaultRegistry.Lookup(bt.Number)
+		assert.True(t, ok, bt.Name)
+		assert.Equal(t, bt.Name, dt.Name)
+		assert.Equal(t, bt.Encode, funcName(dt.Encode), bt.Name)
+		assert.Equal(t, bt.Decode, funcName(dt.Decode), bt.Name)
+	}
+
+	samples := map[string]interface{}{
+		"int": 5, "uint": uint8(5), "float": float32(1.5), "complex": complex(1, 2), "bool": true,
+		"string": "x", "bytes": [2]byte{1, 2}, "time": time.Unix(1600000000, 0), "decimal": NewDecimal(big.NewInt(5), -1),
+		"bigint": big.NewInt(5),
+	}
+	for class, sample := range samples {
+		val := reflect.ValueOf(sample)
+		if class != "time" && class != "decimal" && class != "bigint" {
+			assert.Equal(t, class, b3tag.KindClass(val.Type()))
+		}
+		allowed := map[string]bool{}
+		for _, name := range b3tag.ClassDataTypes[class] {
+			allowed[name] = true
+		}
+		for _, dt := range DefaultRegistry.DataTypes() {
+			ifVal, err := fieldValueForEncode(val, dt.Number)
+			if err == nil {
+				_, err = dt.Encode(ifVal)
+			}
+			assert.Equal(t, allowed[dt.Name], err == nil, "%s as %s", class, dt.Name)
+		}
+	}
+	assert.Equal(t, len(samples), len(b3tag.ClassDataTypes))
+}
+
+func TestRegistryRegisterErrors(t *testing.T) {
+	r := NewDefaultRegistry()
+	assert.EqualError(t, r.Register(DataType{-1, "FOO", encodeTestColour, decodeTestColour}), "-ve data types not permitted")
+	for _, n := range []int{0, B3_COMPOSITE_DICT, B3_COMPOSITE_LIST} {
+		assert.EqualError(t, r.Register(DataType{n, "FOO", encodeTestColour, decodeTestColour}), fmt.Sprintf("data type number %d is reserved", n))
+	}
+	assert.EqualError(t, r.Register(DataType{555, "", encodeTestColour, decodeTestColour}), "data type name is empty")
+	assert.EqualError(t, r.Register(DataType{555, "FOO", nil, decodeTestColour}), "data type FOO needs both an encoder and a decoder")
+	assert.EqualError(t, r.Register(DataType{7, "FOO", encodeTestColour, decodeTestColour}), "data type number 7 already registered as UVARINT")
+	assert.EqualError(t, r.Register(DataType{555, "UTF8", encodeTestColour, decodeTestColour}), "data type name UTF8 already registered as number 4")
+}
+
+type colourStruct struct {
+	Fg testColour `b3.tag:"1" b3.type:"COLOUR"`
+	Bg testColour `b3.tag:"2" b3.type:"COLOUR"`
+}
+
+func TestRegistryExtendedTypeStruct(t *testing.T) {
+	r := NewDefaultRegistry()
+	assert.Nil(t, r.Register(testColourType))
+
+	src := colourStruct{testColour{1, 2, 3}, testColour{}}
+	buf, err := r.StructToBuf(src)
+	assert.Nil(t, err)
+	//                      ext type 555   key  len  data       ext type 555, key, compact zero
+	assert.Equal(t, SBytes("5f ab 04      01   03   01 02 03   1f ab 04 02"), buf)
+
+	dst := colourStruct{}
+	assert.Nil(t, r.BufToStruct(buf, len(buf), &dst))
+	assert.Equal(t, src, dst)
+
+	// isolated - the default registry doesn't know about COLOUR
+	_, err = StructToBuf(src)
+	assert.Error(t, err)
+	assert.Error(t, BufToStruct(buf, len(buf), &dst))
+}
+
+func TestRegistryClone(t *testing.T) {
+	r := NewRegistry()
+	assert.Nil(t, r.Register(testColourType))
+	c := r.Clone()
+	assert.Nil(t, c.Register(DataType{556, "COLOUR2", encodeTestColour, decodeTestColour}))
+	_, ok := r.Lookup(556)
+	assert.False(t, ok)
+	_, ok = c.Lookup(555)
+	assert.True(t, ok)
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	r := NewDefaultRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = r.Register(DataType{100 + i, "T" + string(rune('A'+i)), encodeTestColour, decodeTestColour})
+			for j := 0; j < 100; j++ {
+				_, _ = r.Lookup(B3_UTF8)
+				_, _ = r.LookupName("UVARINT")
+				_ = r.DataTypes()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, len(builtinDataTypes)+8, len(r.DataTypes()))
+}
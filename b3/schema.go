@@ -0,0 +1,236 @@
+package b3
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// A structSchema is everything about a struct type's b3 fields, worked out once per type and cached in the
+// registry (see schemaFor), so encoding and decoding don't re-parse the struct tags for every field and item.
+// Tag mistakes are errors when the schema is compiled, before anything is encoded or decoded.
+type structSchema struct {
+	fields         []schemaField // in struct field order
+	byTag          map[int]*schemaField
+	byKey          map[string]*schemaField
+	required       []*schemaField
+	intKeyOrder    []keyedField // in the order they're encoded, with IntKeys
+	stringKeyOrder []keyedField // and with StringKeys
+}
+
+// A field and its item key, boxed once here rather than every time it's encoded.
+type keyedField struct {
+	key   interface{}
+	field *schemaField
+}
+
+type schemaField struct {
+	fieldTag
+	index  int    // struct field number
+	name   string // struct field name
+	scalar bool   // a plain value that can go straight to dt's codec, see scalarDataType
+	dt     DataType
+}
+
+// The field for an incoming item key.
+func (s *structSchema) field(key interface{}) (*schemaField, bool) {
+	var sf *schemaField
+	switch k := key.(type) {
+	case int:
+		sf = s.byTag[k]
+	case string:
+		sf = s.byKey[k]
+	}
+	return sf, sf != nil
+}
+
+// schemaFor returns the cached schema for a struct type, compiling it first if need be. Errors aren't
+// cached - a b3.type might be registered later.
+func (r *Registry) schemaFor(t reflect.Type, path string) (*structSchema, error) {
+	if s, ok := r.schemas.Load(t); ok {
+		return s.(*structSchema), nil
+	}
+	s, err := r.compileSchema(t, path)
+	if err != nil {
+		return nil, err
+	}
+	r.schemas.Store(t, s)
+	return s, nil
+}
+
+func (r *Registry) compileSchema(t reflect.Type, path string) (*structSchema, error) {
+	s := &structSchema{byTag: map[int]*schemaField{}, byKey: map[string]*schemaField{}}
+	for i := 0; i < t.NumField(); i++ {
+		tfield := t.Field(i)
+		fieldPath := joinPath(path, tfield.Name)
+		ft, isB3, err := parseFieldTag(tfield)
+		if err != nil {
+			return nil, fieldError(err, fieldPath)
+		}
+		if !isB3 {
+			continue
+		}
+		if tfield.PkgPath != "" {
+			return nil, fieldError(errors.New("b3 tagged field is unexported"), fieldPath)
+		}
+		if ft.TypeName != "" && ft.TypeName != "DICT" && ft.TypeName != "LIST" {
+			if _, ok := r.LookupName(ft.TypeName); !ok {
+				return nil, fieldError(errors.Errorf("struct b3.type name %s not found in b3 types", ft.TypeName), fieldPath)
+			}
+		}
+		if err := r.checkFieldType(tfield.Type, ft.TypeName); err != nil {
+			return nil, fieldError(err, fieldPath)
+		}
+		sf := schemaField{fieldTag: ft, index: i, name: tfield.Name}
+		sf.dt, sf.scalar = r.scalarDataType(tfield.Type, ft.TypeName)
+		s.fields = append(s.fields, sf)
+	}
+
+	// the maps point into s.fields, so fill them in once it's stopped growing.
+	for i := range s.fields {
+		sf := &s.fields[i]
+		if sf.HasTag {
+			if other, dup := s.byTag[sf.Tag]; dup {
+				return nil, fieldError(errors.Errorf("duplicate b3 tag %d, also on field %s", sf.Tag, other.name), joinPath(path, sf.name))
+			}
+			s.byTag[sf.Tag] = sf
+		}
+		if sf.Key != "" {
+			if other, dup := s.byKey[sf.Key]; dup {
+				return nil, fieldError(errors.Errorf("duplicate b3 key %q, also on field %s", sf.Key, other.name), joinPath(path, sf.name))
+			}
+			s.byKey[sf.Key] = sf
+		}
+		if sf.Required {
+			s.required = append(s.required, sf)
+		}
+	}
+	s.intKeyOrder = s.keyOrder(IntKeys)
+	s.stringKeyOrder = s.keyOrder(StringKeys)
+	return s, nil
+}
+
+// The fields sorted by their item keys with that key style, the same as PackDict sorts.
+func (s *structSchema) keyOrder(style KeyStyle) []keyedField {
+	items := make([]dictItem, len(s.fields))
+	for i := range s.fields {
+		items[i] = dictItem{itemKey(s.fields[i].fieldTag, style), &s.fields[i]}
+	}
+	sortDictItems(items)
+	out := make([]keyedField, len(items))
+	for i, item := range items {
+		out[i] = keyedField{item.key, item.value.(*schemaField)}
+	}
+	return out
+}
+
+// Plain values - bools, numbers, strings and bytes with no marshal methods - can go straight to their codec.
+// Anything else (pointers, composites, marshalers) goes the long way, through appendValue/decodeValue.
+func (r *Registry) scalarDataType(t reflect.Type, typeName string) (DataType, bool) {
+	if hasMarshalMethods(t) {
+		return DataType{}, false
+	}
+	kind := t.Kind()
+	switch {
+	case kind == reflect.Bool, kind == reflect.String, isIntKind(kind), isUintKind(kind),
+		kind == reflect.Float32, kind == reflect.Float64, kind == reflect.Complex64, kind == reflect.Complex128:
+	case (kind == reflect.Slice || kind == reflect.Array) && !isList(t, typeName):
+	default:
+		return DataType{}, false
+	}
+	if typeName == "" {
+		typeName = inferTypeName(t)
+	}
+	return r.LookupName(typeName)
+}
+
+func hasMarshalMethods(t reflect.Type) bool {
+	return methodsOf(t).any()&hasMarshalers != 0
+}
+
+// RegisterStruct compiles and caches the schema for a struct type, and the struct types inside it, up front.
+// Call it at startup to find tag mistakes then, rather than with the first message. v can be a struct or a
+// pointer to one.
+func RegisterStruct(v interface{}) error {
+	return DefaultRegistry.RegisterStruct(v)
+}
+
+// RegisterStruct is RegisterStruct using the data types in this registry.
+func (r *Registry) RegisterStruct(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return errors.New("RegisterStruct needs a struct or a pointer to a struct")
+	}
+	return r.registerStruct(t, "", map[reflect.Type]bool{})
+}
+
+func (r *Registry) registerStruct(t reflect.Type, path string, done map[reflect.Type]bool) error {
+	if done[t] {
+		return nil // already done, or a recursive type
+	}
+	done[t] = true
+	s, err := r.schemaFor(t, path)
+	if err != nil {
+		return err
+	}
+	for _, sf := range s.fields {
+		if nested, ok := nestedStructType(t.Field(sf.index).Type, sf.TypeName); ok {
+			if err := r.registerStruct(nested, joinPath(path, sf.name), done); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The struct type inside a field that appendValue would recurse into.
+func nestedStructType(t reflect.Type, typeName string) (reflect.Type, bool) {
+	t, typeName = leafType(t, typeName)
+	if hasMarshalMethods(t) || structTypeName(t) != "" {
+		return nil, false
+	}
+	return t, isNestedStruct(t, typeName)
+}
+
+// The type inside a field that appendValue ends up encoding, and the b3.type it gets, looking through
+// pointers, slices, arrays and maps the same way it does.
+func leafType(t reflect.Type, typeName string) (reflect.Type, string) {
+	for {
+		switch {
+		case t.Kind() == reflect.Ptr && t != bigIntPtrType:
+			t = t.Elem()
+		case hasMarshalMethods(t) || structTypeName(t) != "":
+			return t, typeName
+		case isList(t, typeName):
+			t, typeName = t.Elem(), listElemTypeName(typeName)
+		case t.Kind() == reflect.Map:
+			t, typeName = t.Elem(), dictElemTypeName(typeName)
+		default:
+			return t, typeName
+		}
+	}
+}
+
+// A b3.type the field's values can't go as is a tag mistake, e.g. b3.type UVARINT on a string, or on a
+// []string's elements. Types with marshal methods for the b3.type go by those instead (see marshalField),
+// and MarshalB3 picks its own data type, whatever the b3.type.
+func (r *Registry) checkFieldType(t reflect.Type, typeName string) error {
+	t, typeName = leafType(t, typeName)
+	methods := methodsOf(t).any()
+	switch {
+	case typeName == "", methods&(hasB3Marshaler|hasB3Unmarshaler) != 0:
+		return nil
+	case typeName == "BYTES" && methods&(hasBinaryMarshaler|hasBinaryUnmarshaler) != 0:
+		return nil
+	case typeName == "UTF8" && methods&(hasTextMarshaler|hasTextUnmarshaler) != 0:
+		return nil
+	}
+	dt, ok := r.LookupName(typeName) // (DICT and LIST aren't, and are checked by the encoder)
+	if !ok {
+		return nil
+	}
+	return checkScalarType(t, dt)
+}
@@ -0,0 +1,131 @@
+package b3
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaCompile(t *testing.T) {
+	r := NewDefaultRegistry()
+	s, err := r.schemaFor(reflect.TypeOf(keyedStruct{}), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(s.fields))
+
+	sf, ok := s.field(2)
+	assert.True(t, ok)
+	assert.Equal(t, "Name", sf.name)
+	assert.True(t, sf.scalar)
+	assert.Equal(t, B3_UTF8, sf.dt.Number)
+
+	sf, ok = s.field("extra")
+	assert.True(t, ok)
+	assert.Equal(t, "Extra", sf.name)
+
+	_, ok = s.field(4)
+	assert.False(t, ok)
+	_, ok = s.field([]byte("id"))
+	assert.False(t, ok)
+
+	// cached, so the same one comes back
+	s2, err := r.schemaFor(reflect.TypeOf(keyedStruct{}), "")
+	assert.Nil(t, err)
+	assert.True(t, s == s2)
+}
+
+func TestSchemaScalarFields(t *testing.T) {
+	s, err := DefaultRegistry.schemaFor(reflect.TypeOf(inferredStruct{}), "")
+	assert.Nil(t, err)
+	scalar := map[string]bool{}
+	for _, sf := range s.fields {
+		scalar[sf.name] = sf.scalar
+	}
+	assert.Equal(t, map[string]bool{
+		"Name": true, "Data": true, "Count": true, "Delta": true, "Ratio": true, "Flag": true, "When": false,
+		"Small": true, "Hash": true, "Price": false, "Nums": false, "Ages": false, "Maybe": false, "Big": true,
+	}, scalar)
+}
+
+func TestSchemaErrors(t *testing.T) {
+	type dupTag struct {
+		A int `b3:"1"`
+		B int `b3:"1"`
+	}
+	type dupKey struct {
+		A int `b3:"1,,key=a"`
+		B int `b3:"2,,key=a"`
+	}
+	type unknownType struct {
+		A int `b3:"1,nosuchtype"`
+	}
+	type unexported struct {
+		a int `b3:"1"`
+	}
+	type badTag struct {
+		A int `b3.tag:"one"`
+	}
+	type wrongType struct {
+		A string `b3:"1,uvarint"`
+	}
+	type wrongElemType struct {
+		A map[string][]*time.Time `b3:"1,bool"`
+	}
+	tests := []struct {
+		v   interface{}
+		err string
+	}{
+		{dupTag{}, "struct field B: duplicate b3 tag 1, also on field A"},
+		{dupKey{}, `struct field B: duplicate b3 key "a", also on field A`},
+		{unknownType{}, "struct field A: struct b3.type name NOSUCHTYPE not found in b3 types"},
+		{unexported{}, "struct field a: b3 tagged field is unexported"},
+		{badTag{}, `struct field A: struct b3.tag is not a number: strconv.Atoi: parsing "one": invalid syntax`},
+		{wrongType{}, "struct field A: b3.type UVARINT doesn't go with string"},
+		{wrongElemType{}, "struct field A: b3.type BOOL doesn't go with time.Time"},
+	}
+	for _, test := range tests {
+		assert.EqualError(t, RegisterStruct(test.v), test.err)
+		_, err := StructToBuf(test.v)
+		assert.EqualError(t, err, test.err)
+		ptr := reflect.New(reflect.TypeOf(test.v)).Interface()
+		assert.EqualError(t, BufToStruct([]byte{}, 0, ptr), test.err) // even with no items
+	}
+}
+
+type recursiveStruct struct {
+	Name string           `b3:"1"`
+	Next *recursiveStruct `b3:"2"`
+}
+
+func TestRegisterStruct(t *testing.T) {
+	assert.Nil(t, RegisterStruct(nestedOuter{}))
+	assert.Nil(t, RegisterStruct(&listStruct{}))
+	assert.Nil(t, RegisterStruct(mapStruct{}))
+	assert.Nil(t, RegisterStruct(recursiveStruct{}))
+	assert.EqualError(t, RegisterStruct(5), "RegisterStruct needs a struct or a pointer to a struct")
+	assert.EqualError(t, RegisterStruct(nil), "RegisterStruct needs a struct or a pointer to a struct")
+
+	// nested structs are checked too, wherever they are
+	type badInner struct {
+		X int `b3:"1,nosuchtype"`
+	}
+	type badOuter struct {
+		Inners map[string][]*badInner `b3:"1"`
+	}
+	assert.EqualError(t, RegisterStruct(badOuter{}), "struct field Inners.X: struct b3.type name NOSUCHTYPE not found in b3 types")
+
+	src := recursiveStruct{"a", &recursiveStruct{"b", nil}}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	dst := recursiveStruct{}
+	assert.Nil(t, BufToStruct(buf, len(buf), &dst))
+	assert.Equal(t, src, dst)
+}
+
+func TestSchemaNotCachedOnError(t *testing.T) {
+	r := NewDefaultRegistry()
+	assert.EqualError(t, r.RegisterStruct(colourStruct{}), "struct field Fg: struct b3.type name COLOUR not found in b3 types")
+	assert.Nil(t, r.Register(testColourType))
+	assert.Nil(t, r.RegisterStruct(colourStruct{}))
+}
@@ -0,0 +1,287 @@
+package b3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Streams of messages, for files, pipes and network connections. Each message is one top level item with no
+// key - header then data - so the header says how long it is, and unlike Marshal's output it says its own
+// data type and can be null. A stream is just the messages one after another, no other framing.
+
+// An Encoder writes messages to a stream.
+type Encoder struct {
+	r    *Registry
+	w    io.Writer
+	opts EncodeOptions
+	buf  []byte // reused for each message
+}
+
+// NewEncoder returns an Encoder writing to w. Each message is a single Write, so w doesn't need buffering.
+func NewEncoder(w io.Writer) *Encoder {
+	return DefaultRegistry.NewEncoder(w)
+}
+
+// NewEncoder is NewEncoder using the data types in this registry.
+func (r *Registry) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{r: r, w: w}
+}
+
+// SetOptions sets the options for the following messages, see MarshalOptions.
+func (e *Encoder) SetOptions(opts EncodeOptions) {
+	e.opts = opts
+}
+
+// Encode writes v as the next message. v is anything Marshal takes, and nil or nil pointers make null messages.
+func (e *Encoder) Encode(v interface{}) error {
+	return e.EncodeContext(context.Background(), v)
+}
+
+// EncodeContext is Encode, giving up if ctx is done. Writes that are already blocked only give up if w has
+// a SetWriteDeadline (net.Conn, os.File pipes), which is then left in the past. A message may have been
+// partly written when it gives up, so the stream isn't good for any more after that.
+func (e *Encoder) EncodeContext(ctx context.Context, v interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	if v == nil {
+		e.buf, err = AppendHeader(e.buf[:0], ItemHeader{IsNull: true})
+	} else {
+		e.buf, err = encoder{e.r, e.opts}.appendItem(e.buf[:0], nil, reflect.ValueOf(v), "")
+	}
+	if err != nil {
+		return err
+	}
+
+	var setDeadline func(time.Time) error
+	if d, ok := e.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		setDeadline = d.SetWriteDeadline
+	}
+	stop := watchContext(ctx, setDeadline)
+	_, err = e.w.Write(e.buf)
+	return stop(err)
+}
+
+// A Decoder reads messages from a stream.
+type Decoder struct {
+	r          *Registry
+	rd         io.Reader // for its SetReadDeadline, if it has one
+	br         *bufio.Reader
+	opts       DecodeOptions
+	maxDataLen int
+}
+
+// NewDecoder returns a Decoder reading from rd. It reads ahead, so it may read past the last message it
+// returns - keep using the Decoder rather than rd. rd can be a *bufio.Reader, which is then used as is.
+func NewDecoder(rd io.Reader) *Decoder {
+	return DefaultRegistry.NewDecoder(rd)
+}
+
+// NewDecoder is NewDecoder using the data types in this registry.
+func (r *Registry) NewDecoder(rd io.Reader) *Decoder {
+	br, ok := rd.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(rd)
+	}
+	return &Decoder{r: r, rd: rd, br: br}
+}
+
+// SetOptions sets the options for the following messages, see UnmarshalOptions.
+func (d *Decoder) SetOptions(opts DecodeOptions) {
+	d.opts = opts
+}
+
+// SetMaxDataLen makes messages (and keys) longer than n bytes an error, 0 for no limit (the default).
+// Worth setting when the other end isn't trusted, otherwise a header can ask for any amount of memory.
+func (d *Decoder) SetMaxDataLen(n int) {
+	d.maxDataLen = n
+}
+
+// Decode reads the next message into what v points at. v is anything Unmarshal takes, and can also be an
+// *interface{}, which gets what UnpackDict would give it. At the end of the stream it returns io.EOF, and
+// io.ErrUnexpectedEOF if the stream ends part way through a message.
+func (d *Decoder) Decode(v interface{}) error {
+	return d.DecodeContext(context.Background(), v)
+}
+
+// DecodeContext is Decode, giving up if ctx is done. Reads that are already blocked only give up if the
+// reader has a SetReadDeadline (net.Conn, os.File pipes), which is then left in the past. A message may have
+// been partly read when it gives up, so the stream isn't good for any more after that.
+func (d *Decoder) DecodeContext(ctx context.Context, v interface{}) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return errors.New("Decode needs a non-nil pointer")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var setDeadline func(time.Time) error
+	if dl, ok := d.rd.(interface{ SetReadDeadline(time.Time) error }); ok {
+		setDeadline = dl.SetReadDeadline
+	}
+	stop := watchContext(ctx, setDeadline)
+	hdr, data, err := d.readMessage(ctx)
+	if err = stop(err); err != nil {
+		return err
+	}
+
+	if d.opts.Zero {
+		ptr.Elem().Set(reflect.Zero(ptr.Type().Elem()))
+	}
+	return d.r.decodeValue(ptr.Elem(), "", hdr, data, "", d.opts)
+}
+
+// Read a whole message. io.EOF is only for when there's nothing at all, i.e. between messages.
+func (d *Decoder) readMessage(ctx context.Context) (ItemHeader, []byte, error) {
+	hdrBuf, err := d.readHeader()
+	if err != nil {
+		if err == io.EOF && len(hdrBuf) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return ItemHeader{}, nil, err
+	}
+	hdr, _, err := DecodeHeader(hdrBuf)
+	if err != nil {
+		return hdr, nil, errors.Wrap(err, "stream decode header fail")
+	}
+	if err := d.checkLen(hdr.DataLen); err != nil {
+		return hdr, nil, err
+	}
+
+	// Grow the buffer as the data turns up, rather than trusting the header with the allocation.
+	data := bytes.Buffer{}
+	_, err = io.CopyN(&data, contextReader{ctx, d.br}, int64(hdr.DataLen))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return hdr, data.Bytes(), err
+}
+
+// Read the bytes of an item header, working out from each part how much more there is (see DecodeHeader).
+// Returns what it's read so far with any error.
+func (d *Decoder) readHeader() ([]byte, error) {
+	buf := make([]byte, 0, 16)
+
+	cbyte, err := d.br.ReadByte()
+	if err != nil {
+		return buf, err
+	}
+	buf = append(buf, cbyte)
+
+	if cbyte&0x0f == 15 { // extended data type
+		if buf, _, err = d.readUvarint(buf); err != nil {
+			return buf, err
+		}
+	}
+
+	switch cbyte & 0x30 {
+	case 0x10: // int key
+		if buf, _, err = d.readUvarint(buf); err != nil {
+			return buf, err
+		}
+	case 0x20, 0x30: // string or bytes key, len then the bytes
+		var klen int
+		if buf, klen, err = d.readUvarint(buf); err != nil {
+			return buf, err
+		}
+		if err = d.checkLen(klen); err != nil {
+			return buf, err
+		}
+		for ; klen > 0; klen-- {
+			b, err := d.br.ReadByte()
+			if err != nil {
+				return buf, err
+			}
+			buf = append(buf, b)
+		}
+	}
+
+	if cbyte&0x40 == 0x40 { // has data, so a data len
+		if buf, _, err = d.readUvarint(buf); err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// Read a uvarint's bytes onto buf, returning its value too.
+func (d *Decoder) readUvarint(buf []byte) ([]byte, int, error) {
+	start := len(buf)
+	for {
+		b, err := d.br.ReadByte()
+		if err != nil {
+			return buf, 0, err
+		}
+		buf = append(buf, b)
+		if b&0x80 == 0 {
+			break
+		}
+		if len(buf)-start >= 10 {
+			return buf, 0, errors.New("uvarint > uint64")
+		}
+	}
+	n, _, err := DecodeUvarint(buf[start:])
+	return buf, n, err
+}
+
+func (d *Decoder) checkLen(n int) error {
+	if d.maxDataLen > 0 && n > d.maxDataLen {
+		return errors.Errorf("message item len %d > max %d", n, d.maxDataLen)
+	}
+	return nil
+}
+
+// contextReader stops reading once ctx is done, for readers that can't be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// A time in the past, for deadlines that should go off straight away.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// watchContext arranges for a blocked read or write to give up when ctx is done, if the stream can have
+// deadlines (setDeadline isn't nil). Call the func it returns once the read or write is finished - it makes
+// any error it stopped with ctx's error if ctx is why.
+func watchContext(ctx context.Context, setDeadline func(time.Time) error) func(error) error {
+	result := func(err error) error {
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if ctx.Done() == nil || setDeadline == nil {
+		return result
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = setDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+	return func(err error) error {
+		close(done)
+		<-stopped
+		return result(err)
+	}
+}
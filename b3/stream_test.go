@@ -0,0 +1,135 @@
+package b3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	out := bytes.Buffer{}
+	enc := NewEncoder(&out)
+	src := basicTypesStruct{true, -1, 1.5, complex(1, 2), "foo"}
+	assert.Nil(t, enc.Encode(src))
+	assert.Nil(t, enc.Encode(42))
+	assert.Nil(t, enc.Encode(nil))
+	assert.Nil(t, enc.Encode((*int)(nil)))
+	assert.Nil(t, enc.Encode([]string{"a", "b"}))
+	assert.Nil(t, enc.Encode(map[string]int{"x": 1}))
+
+	structBuf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	want := append(SBytes("41"), EncodeUvarint64(uint64(len(structBuf)))...)
+	want = append(want, structBuf...)
+	want = append(want, SBytes("48 01 54  80  88  42 06 44 01 61 44 01 62  41 05 68 01 78 01 02")...)
+	assert.Equal(t, want, out.Bytes())
+
+	// a byte at a time, to be sure the headers are read incrementally
+	dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(out.Bytes())))
+	dst := basicTypesStruct{}
+	assert.Nil(t, dec.Decode(&dst))
+	assert.Equal(t, src, dst)
+	n := 0
+	assert.Nil(t, dec.Decode(&n))
+	assert.Equal(t, 42, n)
+	var any interface{} = "old"
+	assert.Nil(t, dec.Decode(&any))
+	assert.Nil(t, any)
+	p := &n
+	assert.Nil(t, dec.Decode(&p))
+	assert.Nil(t, p)
+	assert.Nil(t, dec.Decode(&any))
+	assert.Equal(t, []interface{}{"a", "b"}, any)
+	m := map[string]int{}
+	assert.Nil(t, dec.Decode(&m))
+	assert.Equal(t, map[string]int{"x": 1}, m)
+
+	assert.Equal(t, io.EOF, dec.Decode(&any))
+	assert.Equal(t, io.EOF, dec.Decode(&any))
+}
+
+func TestStreamOptions(t *testing.T) {
+	type item struct {
+		Name string `b3:"1,,key=name"`
+		Qty  int    `b3:"2,,key=qty"`
+	}
+	out := bytes.Buffer{}
+	enc := NewEncoder(&out)
+	enc.SetOptions(EncodeOptions{KeyStyle: StringKeys, OmitEmpty: true})
+	assert.Nil(t, enc.Encode(item{Qty: 3}))
+	assert.Equal(t, SBytes("41 07 68 03 71 74 79 01 06"), out.Bytes())
+
+	dec := NewDecoder(bytes.NewReader(SBytes("41 07 68 03 71 74 79 01 06  41 07 68 03 71 74 79 01 06")))
+	dst := item{"old", 0}
+	assert.Nil(t, dec.Decode(&dst))
+	assert.Equal(t, item{"old", 3}, dst)
+	dec.SetOptions(DecodeOptions{Zero: true})
+	dst = item{"old", 0}
+	assert.Nil(t, dec.Decode(&dst))
+	assert.Equal(t, item{"", 3}, dst)
+}
+
+func TestStreamErrors(t *testing.T) {
+	var any interface{}
+	for hexBuf, msg := range map[string]string{
+		"48":       "unexpected EOF", // no data len
+		"48 01":    "unexpected EOF", // no data
+		"64 02 61": "unexpected EOF", // short key
+		"4f 80":    "unexpected EOF", // short extended type
+		"c4 00":    "stream decode header fail: item header invalid state - is_null and has_data both ON",
+	} {
+		dec := NewDecoder(bytes.NewReader(SBytes(hexBuf)))
+		assert.EqualError(t, dec.Decode(&any), msg, hexBuf)
+	}
+
+	dec := NewDecoder(bytes.NewReader(SBytes("44 03 61 62 63")))
+	dec.SetMaxDataLen(2)
+	assert.EqualError(t, dec.Decode(&any), "message item len 3 > max 2")
+
+	dec = NewDecoder(bytes.NewReader(SBytes("44 01 61")))
+	n := 0
+	assert.EqualError(t, dec.Decode(&n), "struct field b3 type mismatch vs incoming data type")
+	assert.EqualError(t, dec.Decode(n), "Decode needs a non-nil pointer")
+	assert.Equal(t, io.EOF, dec.Decode(&n)) // the bad message was still read
+
+	enc := NewEncoder(&bytes.Buffer{})
+	assert.EqualError(t, enc.Encode(make(chan int)), "struct b3.type is invalid")
+}
+
+func TestStreamContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := bytes.Buffer{}
+	assert.Equal(t, context.Canceled, NewEncoder(&out).EncodeContext(ctx, 1))
+	assert.Equal(t, 0, out.Len())
+	n := 0
+	assert.Equal(t, context.Canceled, NewDecoder(&out).DecodeContext(ctx, &n))
+
+	// blocked reads and writes are interrupted, for streams with deadlines
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, NewDecoder(server).DecodeContext(ctx, &n))
+	assert.Equal(t, context.DeadlineExceeded, NewEncoder(client).EncodeContext(ctx, 1))
+
+	// and for ones without, reading the data stops between reads
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		pw.Write(SBytes("44 05 61"))
+		cancel()
+		pw.Write(SBytes("62"))
+		pw.Write(SBytes("63 64 65"))
+	}()
+	s := ""
+	assert.Equal(t, context.Canceled, NewDecoder(pr).DecodeContext(ctx, &s))
+}
@@ -0,0 +1,41 @@
+package b3
+
+import (
+	"reflect"
+
+	"github.com/oddy/b3-go/internal/b3tag"
+)
+
+// Struct fields are tagged either the original way, with separate tags:
+//
+//	Count int `b3.tag:"3" b3.type:"UVARINT" b3.key:"count"`
+//
+// or with one b3 tag in the style of encoding/json - tag number, then b3.type, then options:
+//
+//	Count int `b3:"3,uvarint,omitempty,key=count"`
+//
+// The type name isn't case sensitive, and the number or type can be left empty, e.g. `b3:",,key=count"`.
+// Options are:
+//
+//	omitempty   don't send the field if it's the zero value
+//	required    BufToStruct errors if the field isn't in the data
+//	nullzero    nil pointers go as the zero value, and incoming nulls come in as the zero value (not nil)
+//	key=name    the string key, same as b3.key
+//
+// `b3:"-"` skips the field, like having no tags at all.
+
+// The parsing is shared with cmd/b3gen, so generated code reads tags exactly the same way.
+type fieldTag = b3tag.Field
+
+// parseFieldTag returns ok false for fields that aren't b3 fields.
+func parseFieldTag(field reflect.StructField) (fieldTag, bool, error) {
+	return b3tag.Parse(field.Tag)
+}
+
+// The item key for a field - its tag number, or its key name if that's the key style (or all it has).
+func itemKey(ft fieldTag, style KeyStyle) interface{} {
+	if ft.Key != "" && (style == StringKeys || !ft.HasTag) {
+		return ft.Key
+	}
+	return ft.Tag
+}
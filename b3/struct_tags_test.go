@@ -0,0 +1,132 @@
+package b3
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldTag(t *testing.T) {
+	type tagged struct {
+		Old      int `b3.tag:"1" b3.type:"UVARINT" b3.key:"old"`
+		New      int `b3:"2,uvarint,omitempty,key=new"`
+		KeyOnly  int `b3:",svarint,key=k"`
+		NoType   int `b3:"4,,required,nullzero"`
+		TagOnly  int `b3:"5"`
+		Skipped  int `b3:"-"`
+		Untagged int
+	}
+	tests := []struct {
+		field string
+		ft    fieldTag
+		ok    bool
+	}{
+		{"Old", fieldTag{HasTag: true, Tag: 1, Key: "old", TypeName: "UVARINT"}, true},
+		{"New", fieldTag{HasTag: true, Tag: 2, Key: "new", TypeName: "UVARINT", OmitEmpty: true}, true},
+		{"KeyOnly", fieldTag{Key: "k", TypeName: "SVARINT"}, true},
+		{"NoType", fieldTag{HasTag: true, Tag: 4, Required: true, NullZero: true}, true},
+		{"TagOnly", fieldTag{HasTag: true, Tag: 5}, true},
+		{"Skipped", fieldTag{}, false},
+		{"Untagged", fieldTag{}, false},
+	}
+	typ := reflect.TypeOf(tagged{})
+	for _, test := range tests {
+		field, _ := typ.FieldByName(test.field)
+		ft, ok, err := parseFieldTag(field)
+		assert.Nil(t, err, test.field)
+		assert.Equal(t, test.ok, ok, test.field)
+		assert.Equal(t, test.ft, ft, test.field)
+	}
+}
+
+func TestParseFieldTagErrors(t *testing.T) {
+	type bad1 struct {
+		F int `b3:"x,uvarint"`
+	}
+	type bad2 struct {
+		F int `b3:"1,uvarint,sometimes"`
+	}
+	type bad3 struct {
+		F int `b3:"1" b3.type:"UVARINT"`
+	}
+	type bad4 struct {
+		F int `b3:",uvarint"`
+	}
+	type bad5 struct {
+		F int `b3:"1,,key="`
+	}
+	type bad6 struct {
+		F int `b3:"-1"`
+	}
+	_, err := StructToBuf(bad1{})
+	assert.EqualError(t, err, `struct field F: struct b3.tag is not a number: strconv.Atoi: parsing "x": invalid syntax`)
+	_, err = StructToBuf(bad2{})
+	assert.EqualError(t, err, `struct field F: b3 tag "1,uvarint,sometimes" has unknown option "sometimes"`)
+	_, err = StructToBuf(bad3{})
+	assert.EqualError(t, err, "struct field F: use either the b3 tag or b3.tag/b3.type/b3.key, not both")
+	_, err = StructToBuf(bad4{})
+	assert.EqualError(t, err, `struct field F: b3 tag ",uvarint" needs a tag number or a key=`)
+	_, err = StructToBuf(bad5{})
+	assert.EqualError(t, err, `struct field F: b3 tag "1,,key=" has an empty key=`)
+	_, err = StructToBuf(bad6{})
+	assert.EqualError(t, err, "struct field F: struct b3.tag -1 is negative")
+
+	err = BufToStruct(SBytes("57 01 01 01"), 4, &bad2{})
+	assert.EqualError(t, err, `struct field F: b3 tag "1,uvarint,sometimes" has unknown option "sometimes"`)
+}
+
+type compactTagStruct struct {
+	ID   int     `b3:"1,uvarint,key=id"`
+	Name string  `b3:"2,,omitempty"`
+	Note *string `b3:"3,utf8,nullzero"`
+	Must bool    `b3:"4,,required"`
+	Skip int     `b3:"-"`
+}
+
+func TestStructCompactTags(t *testing.T) {
+	src := compactTagStruct{ID: 5, Name: "", Must: true, Skip: 9}
+	buf, err := StructToBuf(src)
+	assert.Nil(t, err)
+	//                     uvarint 5   Note "" (not null)  bool true		Name omitted, Skip skipped
+	assert.Equal(t, SBytes("57 01 01 05 14 03 55 04 01 01"), buf)
+
+	// same wire format as the two-tag form
+	type oldStyle struct {
+		ID   int    `b3.tag:"1" b3.type:"UVARINT"`
+		Note string `b3.tag:"3" b3.type:"UTF8"`
+		Must bool   `b3.tag:"4" b3.type:"BOOL"`
+	}
+	oldBuf, err := StructToBuf(oldStyle{ID: 5, Must: true})
+	assert.Nil(t, err)
+	assert.Equal(t, oldBuf, buf)
+
+	dst := compactTagStruct{Name: "old"}
+	err = BufToStruct(buf, len(buf), &dst)
+	assert.Nil(t, err)
+	empty := ""
+	assert.Equal(t, compactTagStruct{ID: 5, Name: "old", Note: &empty, Must: true}, dst)
+
+	buf, err = StructToBufOptions(src, EncodeOptions{KeyStyle: StringKeys})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("14 03 55 04 01 01 67 02 69 64 01 05"), buf)
+}
+
+func TestStructRequiredAndNullZero(t *testing.T) {
+	dst := compactTagStruct{}
+	err := BufToStruct(SBytes("57 01 01 05"), 4, &dst)
+	assert.EqualError(t, err, "struct field Must: required field missing")
+
+	// incoming null for a nullzero pointer gives a pointer to the zero value
+	err = BufToStruct(SBytes("94 03 15 04"), 4, &dst)
+	assert.Nil(t, err)
+	assert.NotNil(t, dst.Note)
+	assert.Equal(t, "", *dst.Note)
+
+	type allOmit struct {
+		A int `b3:"1,,omitempty"`
+	}
+	buf, err := StructToBuf(allOmit{})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, buf)
+}
@@ -0,0 +1,42 @@
+package b3
+
+import (
+	"fmt"
+	"io"
+)
+
+// A Tracer is told what decoding is doing, for debugging. Set one in DecodeOptions.Tracer. The methods are
+// called synchronously as the data is decoded, so they should be quick.
+// path is where things are in the top level value, e.g. "Order.Lines[2]", "" for the top level itself.
+type Tracer interface {
+	// HeaderDecoded is called for every item header in a struct, list or dict, with the path of the container.
+	HeaderDecoded(path string, hdr ItemHeader)
+	// FieldSet is called once a struct field is set from an item, with the path of the field.
+	FieldSet(path string, hdr ItemHeader)
+	// UnknownTagSkipped is called for items that aren't for any of a struct's fields, with the path of the struct.
+	UnknownTagSkipped(path string, key interface{})
+}
+
+// WriterTracer is a Tracer that writes a line per event to W, e.g. os.Stderr.
+type WriterTracer struct {
+	W io.Writer
+}
+
+func (t WriterTracer) HeaderDecoded(path string, hdr ItemHeader) {
+	fmt.Fprintf(t.W, "b3: %s: header %+v\n", tracePath(path), hdr)
+}
+
+func (t WriterTracer) FieldSet(path string, hdr ItemHeader) {
+	fmt.Fprintf(t.W, "b3: %s: set from data type %d, %d bytes\n", tracePath(path), hdr.DataType, hdr.DataLen)
+}
+
+func (t WriterTracer) UnknownTagSkipped(path string, key interface{}) {
+	fmt.Fprintf(t.W, "b3: %s: no field for key %v, skipped\n", tracePath(path), key)
+}
+
+func tracePath(path string) string {
+	if path == "" {
+		return "(top)"
+	}
+	return path
+}
@@ -0,0 +1,89 @@
+package b3
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type traceEvent struct {
+	kind string
+	path string
+	arg  interface{}
+}
+
+type recordTracer struct {
+	events []traceEvent
+}
+
+func (t *recordTracer) HeaderDecoded(path string, hdr ItemHeader) {
+	t.events = append(t.events, traceEvent{"header", path, hdr})
+}
+
+func (t *recordTracer) FieldSet(path string, hdr ItemHeader) {
+	t.events = append(t.events, traceEvent{"set", path, hdr.Key})
+}
+
+func (t *recordTracer) UnknownTagSkipped(path string, key interface{}) {
+	t.events = append(t.events, traceEvent{"skip", path, key})
+}
+
+type traceStruct struct {
+	Name  string       `b3:"1"`
+	Inner *traceStruct `b3:"2"`
+	Nums  []int        `b3:"3"`
+}
+
+func TestTracerEvents(t *testing.T) {
+	buf := SBytes("54 01 01 41 51 02 04 54 01 01 42 52 03 02 08 08 54 09 01 78")
+	dst := traceStruct{}
+	tracer := &recordTracer{}
+	assert.Nil(t, UnmarshalOptions(buf, &dst, DecodeOptions{Tracer: tracer}))
+	assert.Equal(t, traceStruct{Name: "A", Inner: &traceStruct{Name: "B"}, Nums: []int{0, 0}}, dst)
+
+	assert.Equal(t, []traceEvent{
+		{"header", "", ItemHeader{DataType: B3_UTF8, Key: 1, DataLen: 1}},
+		{"set", "Name", 1},
+		{"header", "", ItemHeader{DataType: B3_COMPOSITE_DICT, Key: 2, DataLen: 4}},
+		{"header", "Inner", ItemHeader{DataType: B3_UTF8, Key: 1, DataLen: 1}},
+		{"set", "Inner.Name", 1},
+		{"set", "Inner", 2},
+		{"header", "", ItemHeader{DataType: B3_COMPOSITE_LIST, Key: 3, DataLen: 2}},
+		{"header", "Nums", ItemHeader{DataType: B3_SVARINT}},
+		{"header", "Nums", ItemHeader{DataType: B3_SVARINT}},
+		{"set", "Nums", 3},
+		{"header", "", ItemHeader{DataType: B3_UTF8, Key: 9, DataLen: 1}},
+		{"skip", "", 9},
+	}, tracer.events)
+}
+
+func TestTracerBufToStruct(t *testing.T) {
+	buf := SBytes("54 01 01 41 51 02 04 54 01 01 42 52 03 02 08 08 54 09 01 78")
+	want := &recordTracer{}
+	assert.Nil(t, UnmarshalOptions(buf, &traceStruct{}, DecodeOptions{Tracer: want}))
+
+	dst := traceStruct{}
+	tracer := &recordTracer{}
+	assert.Nil(t, BufToStructOptions(buf, len(buf), &dst, DecodeOptions{Tracer: tracer}))
+	assert.Equal(t, traceStruct{Name: "A", Inner: &traceStruct{Name: "B"}, Nums: []int{0, 0}}, dst)
+	assert.Equal(t, want.events, tracer.events)
+
+	err := BufToStructOptions(buf, len(buf), &dst, DecodeOptions{Strict: true})
+	assert.EqualError(t, err, "no struct field for item key 9")
+
+	dst = traceStruct{Nums: []int{1}}
+	assert.Nil(t, BufToStructOptions(SBytes("54 01 01 41"), 4, &dst, DecodeOptions{Zero: true}))
+	assert.Equal(t, traceStruct{Name: "A"}, dst)
+}
+
+func TestTracerWriter(t *testing.T) {
+	out := bytes.Buffer{}
+	dst := traceStruct{}
+	err := UnmarshalOptions(SBytes("54 01 01 41 14 09"), &dst, DecodeOptions{Tracer: WriterTracer{&out}})
+	assert.Nil(t, err)
+	assert.Equal(t, "b3: (top): header {DataType:4 Key:1 IsNull:false DataLen:1}\n"+
+		"b3: Name: set from data type 4, 1 bytes\n"+
+		"b3: (top): header {DataType:4 Key:9 IsNull:false DataLen:0}\n"+
+		"b3: (top): no field for key 9, skipped\n", out.String())
+}
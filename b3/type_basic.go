@@ -3,7 +3,10 @@ package b3
 import (
 	"encoding/binary"
 	"math"
+	"math/big"
+	"time"
 
+	"github.com/oddy/b3-go/internal/b3tag"
 	"github.com/pkg/errors"
 )
 
@@ -15,48 +18,96 @@ import (
 // https://stackoverflow.com/questions/34861479/how-to-detect-when-bytes-cant-be-converted-to-string-in-go
 
 func DecodeUtf8(buf []byte) (interface{}, error) {
-	return string(buf),nil
+	return string(buf), nil
 }
 func DecodeBytes(buf []byte) (interface{}, error) {
-	return buf,nil											// a no-op but interface{} is returned.
+	return buf, nil // a no-op but interface{} is returned.
 }
 
+// UVARINTs come back as the smallest of int, uint64 or *big.Int that holds them, so small numbers stay plain ints.
+// (int is 32 bits on some platforms, so what's small enough depends.)
+
 func CodecDecodeUvarint(buf []byte) (interface{}, error) {
-	n, _, err := DecodeUvarint(buf)						// we dont need bytesUsed because we're sized already.S
-	return n,err
+	if len(buf) == 0 {
+		return 0, nil // Compact zero-value
+	}
+	n, _, err := DecodeUvarint64(buf) // we dont need bytesUsed because we're sized already.S
+	if err != nil {
+		bn, _, berr := DecodeUvarintBig(buf) // too big for uint64 (or broken, in which case this fails too)
+		if berr != nil {
+			return nil, berr
+		}
+		return bn, nil
+	}
+	if n > uint64(maxInt) {
+		return n, nil
+	}
+	return int(n), nil
+}
+
+// SVARINTs come back as int, or int64 if they don't fit an int (only on 32 bit platforms).
+func CodecDecodeSvarint(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return 0, nil // Compact zero-value
+	}
+	n, _, err := DecodeSvarint64(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(maxInt) || n < -int64(maxInt)-1 {
+		return n, nil
+	}
+	return int(n), nil
 }
 
 type B3DecodeFunc func([]byte) (interface{}, error)
 type B3EncodeFunc func(interface{}) ([]byte, error)
 
-const B3_BYTES	 = 3
-const B3_UTF8	 = 4
+// Data type numbers are the same as the python reference implementation's.
+const B3_BYTES = 3
+const B3_UTF8 = 4
+const B3_BOOL = 5
+const B3_INT64 = 6
 const B3_UVARINT = 7
-
-var B3_DECODE_FUNCS = map[int]B3DecodeFunc{
-	B3_BYTES:	DecodeBytes,
-	B3_UTF8:	DecodeUtf8,
-	B3_UVARINT:	CodecDecodeUvarint,
-}
-
-var B3_ENCODE_FUNCS = map[int]B3EncodeFunc{
-	B3_BYTES:	EncodeBytes,
-	B3_UTF8:	EncodeUtf8,
-	B3_UVARINT:	CodecEncodeUvarint,
-}
-
-var B3_TYPE_NAMES_TO_NUMBERS = map[string]int {
-	"BYTES": 3,
-	"UTF8": 4,
-	"UVARINT":7,
+const B3_SVARINT = 8
+const B3_FLOAT64 = 9
+const B3_DECIMAL = 10
+const B3_SCHED = 11
+const B3_STAMP64 = 12
+const B3_COMPLEX = 13
+
+// The built-in data types, these go in every registry made with NewDefaultRegistry (and so DefaultRegistry).
+// Their numbers and names come from the table cmd/b3gen uses too, the codecs from here.
+var builtinDataTypes = func() []DataType {
+	out := make([]DataType, 0, len(b3tag.Builtins))
+	for _, bt := range b3tag.Builtins {
+		codec := builtinCodecs[bt.Number]
+		out = append(out, DataType{bt.Number, bt.Name, codec.encode, codec.decode})
+	}
+	return out
+}()
+
+var builtinCodecs = map[int]struct {
+	encode B3EncodeFunc
+	decode B3DecodeFunc
+}{
+	B3_BYTES:   {EncodeBytes, DecodeBytes},
+	B3_UTF8:    {EncodeUtf8, DecodeUtf8},
+	B3_BOOL:    {EncodeBool, DecodeBool},
+	B3_INT64:   {EncodeInt64, DecodeInt64},
+	B3_UVARINT: {CodecEncodeUvarint, CodecDecodeUvarint},
+	B3_SVARINT: {CodecEncodeSvarint, CodecDecodeSvarint},
+	B3_FLOAT64: {EncodeFloat64, DecodeFloat64},
+	B3_DECIMAL: {EncodeDecimal, DecodeDecimal},
+	B3_SCHED:   {EncodeSched, DecodeSched},
+	B3_STAMP64: {EncodeStamp64, DecodeStamp64},
+	B3_COMPLEX: {EncodeComplex, DecodeComplex},
 }
 
 // ===================== Temporary B3 basic decoders ===========================
 
-
-
-
 // Method: Encoders assemble [][]byte of []byte, then bytes.Join() them. We take advantage of this often for empty/nonexistant fields etc.
+// Later:  the Append versions append to a caller's buffer instead, and the Encode ones are those appending to nothing.
 // Method: Decoders always take the a slice, and do NOT have to return an updated index.
 // Note:   opposite to python, slicing is cheap, so we API using slices instead of a buffer+index.
 //         In this respect, the Go function apis/contract/signatures are cleaner.
@@ -65,7 +116,6 @@ var B3_TYPE_NAMES_TO_NUMBERS = map[string]int {
 // Policu: Decoders MUST accept len(buf)==0 and return a Zero value (mandatory)
 // Policy: Favouring simplicity over performance by having the type safety checks here.
 
-
 // up-level wants interface{} to come in to the encoders.
 // we type-assertion them and have to return an error if the type conversion doesn't pan out.
 
@@ -84,107 +134,217 @@ var B3_TYPE_NAMES_TO_NUMBERS = map[string]int {
 // with the struct we are using b3 type-name struct tags to drive selection of encoders.
 
 func CodecEncodeUvarint(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.(int)
-	if !ok {
-		return nil, errors.New("EncodeUvarint input not int")
+	switch value := ifValue.(type) {
+	case int:
+		if value < 0 {
+			return nil, errors.New("EncodeUvarint input is negative")
+		}
+		return AppendUvarint64(nil, uint64(value)), nil
+	case uint64:
+		return EncodeUvarint64(value), nil
+	case *big.Int:
+		if value == nil {
+			return nil, errors.New("EncodeUvarint input is nil *big.Int")
+		}
+		return EncodeUvarintBig(value)
+	default:
+		return nil, errors.New("EncodeUvarint input not int, uint64 or *big.Int")
 	}
-	out := EncodeUvarint(value)
-	return out,nil
 }
 
+func CodecEncodeSvarint(ifValue interface{}) ([]byte, error) {
+	switch value := ifValue.(type) {
+	case int:
+		return EncodeSvarint(value), nil // zig-zag, so -ves are small too
+	case int64:
+		return AppendSvarint64(nil, value), nil
+	default:
+		return nil, errors.New("EncodeSvarint input not int or int64")
+	}
+}
 
 func EncodeBytes(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.([]byte)
+	value, ok := ifValue.([]byte)
 	if !ok {
 		return nil, errors.New("EncodeBytes input not []byte")
 	}
-	return value,nil		// direct pass-through, pretty much
+	return value, nil // direct pass-through, pretty much
 }
 
-
 func EncodeBool(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.(bool)
+	value, ok := ifValue.(bool)
 	if !ok {
 		return nil, errors.New("EncodeBool input not bool")
 	}
-	if value {
-		return []byte{0x01}, nil
-	} else {
-		return []byte{}, nil						// Compact zero-value for false.
-	}
+	return AppendBool([]byte{}, value), nil
 }
 
-
 func EncodeUtf8(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.(string)
+	value, ok := ifValue.(string)
 	if !ok {
 		return nil, errors.New("EncodeUtf8 input not string")
 	}
-	return []byte(value), nil					// Strings in go are already utf8 byte arrays, score!
-	// note that this is a copy
+	return AppendUtf8([]byte{}, value), nil
 }
 
 // "Converting between int64 and uint64 doesn't change the sign bit, only the way it's interpreted."
 // This seems to work! It matched the python bytes out anyway.
 
 func EncodeInt64(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.(uint64)
+	value, ok := ifValue.(int64)
 	if !ok {
 		return nil, errors.New("EncodeInt64 input not convertable to int64")
 	}
-	if value == 0 {
-		return []byte{}, nil											// output compact zero value
-	}
-	out := make([]byte, 8)
-	binary.LittleEndian.PutUint64(out, value)
-	return out,nil
+	return AppendInt64([]byte{}, value), nil
 }
 
 func EncodeFloat64(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.(float64)
+	value, ok := ifValue.(float64)
 	if !ok {
 		return nil, errors.New("EncodeFloat64 input not convertable to float64")
 	}
-
-	if value == 0 {
-		return []byte{}, nil									// CZV
-	}
-	outU64 := math.Float64bits(value)
-	out := make([]byte, 8)
-	binary.LittleEndian.PutUint64(out, outU64)
-	return out, nil
+	return AppendFloat64([]byte{}, value), nil
 }
 
+// Stamp64 only accepts time.Time. Unix nanoseconds in an int64 covers years 1678 to 2262, outside that is an error
+// (UnixNano is undefined there, so we'd silently send garbage otherwise).
+// Go's time.Time{} zero value is year 1, so it gets the compact zero-value rather than the epoch.
 
-// Currently Stamp64 only accepts time.Time. If we wanted it to accept other things,
-// it would grow an error return which means all the other encoders would grow an error return too.
-// this may still happen.
+var minStamp64 = time.Unix(0, math.MinInt64)
+var maxStamp64 = time.Unix(0, math.MaxInt64)
 
-// come back to this one.
-//
-/*
-func EncodeStamp64(value time.Time) []byte {
-	nano := value.UnixNano()
-	out := make([]byte, 8)
-	binary.LittleEndian.PutUint64(out, uint64(nano))
-	return out
+func EncodeStamp64(ifValue interface{}) ([]byte, error) {
+	value, ok := ifValue.(time.Time)
+	if !ok {
+		return nil, errors.New("EncodeStamp64 input not time.Time")
+	}
+	out, err := AppendStamp64([]byte{}, value)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
-*/
 
 func EncodeComplex(ifValue interface{}) ([]byte, error) {
-	value,ok := ifValue.(complex128)
+	value, ok := ifValue.(complex128)
 	if !ok {
 		return nil, errors.New("EncodeComplex input not convertable to complex128")
 	}
+	return AppendComplex([]byte{}, value), nil
+}
+
+// ===================== B3 basic append encoders ===========================
 
-	if value == 0 {								// confirmed this works, nice syntactic sugar
-		return []byte{}, nil
+// These are the encoders for concrete types, appending to dst like AppendUvarint64. Zero values append
+// nothing, the compact zero-value.
+
+func AppendBytes(dst []byte, value []byte) []byte {
+	return append(dst, value...)
+}
+
+func AppendUtf8(dst []byte, value string) []byte {
+	return append(dst, value...) // Strings in go are already utf8 byte arrays, score!
+}
+
+func AppendBool(dst []byte, value bool) []byte {
+	if value {
+		return append(dst, 0x01)
 	}
-	out := make([]byte, 16)
-	binary.LittleEndian.PutUint64(out,     math.Float64bits(real(value)))
-	binary.LittleEndian.PutUint64(out[8:], math.Float64bits(imag(value)))
-	return out, nil
+	return dst // Compact zero-value for false.
 }
 
+func AppendInt64(dst []byte, value int64) []byte {
+	if value == 0 {
+		return dst // output compact zero value
+	}
+	return appendUint64LE(dst, uint64(value))
+}
+
+func AppendFloat64(dst []byte, value float64) []byte {
+	if value == 0 {
+		return dst // CZV
+	}
+	return appendUint64LE(dst, math.Float64bits(value))
+}
+
+func AppendStamp64(dst []byte, value time.Time) ([]byte, error) {
+	if value.IsZero() {
+		return dst, nil // CZV
+	}
+	if value.Before(minStamp64) || value.After(maxStamp64) {
+		return dst, errors.New("EncodeStamp64 time out of int64 nanosecond range")
+	}
+	return appendUint64LE(dst, uint64(value.UnixNano())), nil
+}
+
+func AppendComplex(dst []byte, value complex128) []byte {
+	if value == 0 { // confirmed this works, nice syntactic sugar
+		return dst
+	}
+	dst = appendUint64LE(dst, math.Float64bits(real(value)))
+	return appendUint64LE(dst, math.Float64bits(imag(value)))
+}
+
+func appendUint64LE(dst []byte, x uint64) []byte {
+	dst = append(dst, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(dst[len(dst)-8:], x)
+	return dst
+}
 
+// ===================== B3 basic decoders ===========================
 
+// Policy: fixed-size decoders take len 0 as the compact zero value, and anything else that isn't exactly
+//         their size is an error, rather than reading off the end (panic) or silently ignoring the rest.
+
+func DecodeBool(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return false, nil // Compact zero-value
+	}
+	if len(buf) != 1 {
+		return nil, errors.New("DecodeBool data len not 1")
+	}
+	return buf[0] != 0x00, nil // python does bool(buf[index]) too
+}
+
+func DecodeInt64(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return int64(0), nil
+	}
+	if len(buf) != 8 {
+		return nil, errors.New("DecodeInt64 data len not 8")
+	}
+	return int64(binary.LittleEndian.Uint64(buf)), nil // same sign-bit trick as the encoder, in reverse
+}
+
+func DecodeFloat64(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return float64(0), nil
+	}
+	if len(buf) != 8 {
+		return nil, errors.New("DecodeFloat64 data len not 8")
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+}
+
+func DecodeStamp64(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return time.Time{}, nil // go's zero time, see EncodeStamp64
+	}
+	if len(buf) != 8 {
+		return nil, errors.New("DecodeStamp64 data len not 8")
+	}
+	nano := int64(binary.LittleEndian.Uint64(buf))
+	return time.Unix(0, nano).UTC(), nil
+}
+
+func DecodeComplex(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return complex128(0), nil
+	}
+	if len(buf) != 16 {
+		return nil, errors.New("DecodeComplex data len not 16")
+	}
+	re := math.Float64frombits(binary.LittleEndian.Uint64(buf))
+	im := math.Float64frombits(binary.LittleEndian.Uint64(buf[8:]))
+	return complex(re, im), nil
+}
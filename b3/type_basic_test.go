@@ -1,49 +1,208 @@
 package b3
 
 import (
+	"math"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// encoders return ([]byte, error) now, so wrap them for the single-value asserts.
+func mustEnc(t *testing.T, fn B3EncodeFunc, value interface{}) []byte {
+	buf, err := fn(value)
+	assert.Nil(t, err)
+	return buf
+}
+
 func TestBaseBoolEnc(t *testing.T) {
-	assert.Equal(t, SBytes("01"), EncodeBool(true))
-	assert.Equal(t, SBytes(""),   EncodeBool(false))
+	assert.Equal(t, SBytes("01"), mustEnc(t, EncodeBool, true))
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeBool, false))
 }
 
 func TestBaseUtf8Enc(t *testing.T) {
-	assert.Equal(t, SBytes("68 65 6c 6c 6f 20 77 6f 72 6c 64"), EncodeUtf8("hello world"))
-	assert.Equal(t, SBytes("d0 92 d0 b8 d0 b0 d0 b3 d1 80 d0 b0"), EncodeUtf8("Виагра"))										// Viagra OWEN
-	assert.Equal(t, SBytes("e2 9c 88 e2 9c 89 f0 9f 9a 80 f0 9f 9a b8 f0 9f 9a bc f0 9f 9a bd"), EncodeUtf8("✈✉🚀🚸🚼🚽"))		// SMP
-	assert.Equal(t, SBytes(""), EncodeUtf8(""))
+	assert.Equal(t, SBytes("68 65 6c 6c 6f 20 77 6f 72 6c 64"), mustEnc(t, EncodeUtf8, "hello world"))
+	assert.Equal(t, SBytes("d0 92 d0 b8 d0 b0 d0 b3 d1 80 d0 b0"), mustEnc(t, EncodeUtf8, "Виагра"))                               // Viagra OWEN
+	assert.Equal(t, SBytes("e2 9c 88 e2 9c 89 f0 9f 9a 80 f0 9f 9a b8 f0 9f 9a bc f0 9f 9a bd"), mustEnc(t, EncodeUtf8, "✈✉🚀🚸🚼🚽")) // SMP
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeUtf8, ""))
 }
 
 func TestBaseInt64Enc(t *testing.T) {
-	assert.Equal(t, SBytes("15 cd 5b 07 00 00 00 00"), EncodeInt64(123456789))
-	assert.Equal(t, SBytes("eb 32 a4 f8 ff ff ff ff"), EncodeInt64(-123456789))
-	assert.Equal(t, SBytes(""), EncodeInt64(0))
+	assert.Equal(t, SBytes("15 cd 5b 07 00 00 00 00"), mustEnc(t, EncodeInt64, int64(123456789)))
+	assert.Equal(t, SBytes("eb 32 a4 f8 ff ff ff ff"), mustEnc(t, EncodeInt64, int64(-123456789)))
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeInt64, int64(0)))
+	_, err := EncodeInt64(uint64(5))
+	assert.Error(t, err)
 }
 
 func TestBaseFloat64Enc(t *testing.T) {
-	assert.Equal(t, SBytes("a1 f8 31 e6 d6 1c c8 40"), EncodeFloat64(12345.6789))
-	assert.Equal(t, SBytes(""), EncodeFloat64(0.0))
+	assert.Equal(t, SBytes("a1 f8 31 e6 d6 1c c8 40"), mustEnc(t, EncodeFloat64, 12345.6789))
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeFloat64, 0.0))
 }
 
-/*
 func TestBaseStamp64Enc(t *testing.T) {
-	nn := time.Now()
-	buf := EncodeStamp64(nn)
-	//fmt.Println(nn)
-	//fmt.Println(buf)
-	//Hexdump(buf, 8)
+	tm := time.Date(2020, 10, 21, 1, 2, 3, 456789, time.UTC) // 1603242123000456789 ns
+	assert.Equal(t, SBytes("55 a6 62 6e 37 dc 3f 16"), mustEnc(t, EncodeStamp64, tm))
+	assert.Equal(t, SBytes("00 00 00 00 00 00 00 00"), mustEnc(t, EncodeStamp64, time.Unix(0, 0)))
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeStamp64, time.Time{}))
+
+	_, err := EncodeStamp64(time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Error(t, err)
+	_, err = EncodeStamp64(int64(5))
+	assert.Error(t, err)
 }
-*/
 
+func TestBaseStamp64Dec(t *testing.T) {
+	loc := time.FixedZone("NZDT", 13*3600)
+	tm := time.Date(2020, 10, 21, 14, 2, 3, 456789, loc)
+	val, err := DecodeStamp64(mustEnc(t, EncodeStamp64, tm))
+	assert.Nil(t, err)
+	assert.True(t, tm.Equal(val.(time.Time)))
+	assert.Equal(t, time.UTC, val.(time.Time).Location())
 
+	val, err = DecodeStamp64(SBytes(""))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Time{}, val)
+}
 
 func TestBaseComplexEnc(t *testing.T) {
 	tcplx := complex(13.37, 42.42)
 	tcplxBytes := SBytes("3d 0a d7 a3 70 bd 2a 40 f6 28 5c 8f c2 35 45 40")
-	assert.Equal(t, tcplxBytes, EncodeComplex(tcplx))
+	assert.Equal(t, tcplxBytes, mustEnc(t, EncodeComplex, tcplx))
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeComplex, complex128(0)))
+}
+
+// --- Decoders ---
+
+func TestBaseDec(t *testing.T) {
+	tests := []struct {
+		fn    B3DecodeFunc
+		input []byte
+		val   interface{}
+	}{
+		{DecodeBool, SBytes("01"), true},
+		{DecodeBool, SBytes("00"), false},
+		{DecodeBool, SBytes(""), false}, // compact zero-value
+		{DecodeInt64, SBytes("15 cd 5b 07 00 00 00 00"), int64(123456789)},
+		{DecodeInt64, SBytes("eb 32 a4 f8 ff ff ff ff"), int64(-123456789)},
+		{DecodeInt64, SBytes(""), int64(0)},
+		{DecodeFloat64, SBytes("a1 f8 31 e6 d6 1c c8 40"), 12345.6789},
+		{DecodeFloat64, SBytes(""), 0.0},
+		{DecodeComplex, SBytes("3d 0a d7 a3 70 bd 2a 40 f6 28 5c 8f c2 35 45 40"), complex(13.37, 42.42)},
+		{DecodeComplex, SBytes(""), complex128(0)},
+		{CodecDecodeUvarint, SBytes(""), 0},
+	}
+	for _, test := range tests {
+		val, err := test.fn(test.input)
+		assert.Nil(t, err)
+		assert.Equal(t, test.val, val)
+	}
+}
+
+func TestBaseDecBadLen(t *testing.T) {
+	for _, fn := range []B3DecodeFunc{DecodeBool, DecodeInt64, DecodeFloat64, DecodeComplex} {
+		_, err := fn(SBytes("01 02 03"))
+		assert.Error(t, err)
+	}
+}
+
+// zig-zag vectors as emitted by the python reference's encode_svarint
+func TestBaseSvarintCodec(t *testing.T) {
+	tests := []struct {
+		val int
+		buf []byte
+	}{
+		{0, SBytes("00")},
+		{-1, SBytes("01")},
+		{1, SBytes("02")},
+		{-2, SBytes("03")},
+		{2, SBytes("04")},
+		{63, SBytes("7e")},
+		{-64, SBytes("7f")},
+		{64, SBytes("80 01")},
+		{-50, SBytes("63")},
+		{123456789, SBytes("aa b4 de 75")},
+		{-123456789, SBytes("a9 b4 de 75")},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.buf, mustEnc(t, CodecEncodeSvarint, test.val))
+		val, err := CodecDecodeSvarint(test.buf)
+		assert.Nil(t, err)
+		assert.Equal(t, test.val, val)
+	}
+	val, err := CodecDecodeSvarint(SBytes("")) // compact zero-value
+	assert.Nil(t, err)
+	assert.Equal(t, 0, val)
+	_, err = CodecEncodeSvarint("foo")
+	assert.Error(t, err)
 }
 
+func TestBaseUvarintCodec(t *testing.T) {
+	twoTo64, _ := new(big.Int).SetString("18446744073709551616", 10)
+	assert.Equal(t, SBytes("32"), mustEnc(t, CodecEncodeUvarint, 50))
+	assert.Equal(t, SBytes("ff ff ff ff ff ff ff ff ff 01"), mustEnc(t, CodecEncodeUvarint, uint64(math.MaxUint64)))
+	assert.Equal(t, SBytes("80 80 80 80 80 80 80 80 80 02"), mustEnc(t, CodecEncodeUvarint, twoTo64))
+
+	_, err := CodecEncodeUvarint(-1)
+	assert.Error(t, err)
+	_, err = CodecEncodeUvarint(big.NewInt(-1))
+	assert.Error(t, err)
+
+	// decoded as the smallest of int, uint64, *big.Int that fits.
+	val, err := CodecDecodeUvarint(SBytes("ff ff ff ff ff ff ff ff 7f"))
+	assert.Nil(t, err)
+	assert.Equal(t, math.MaxInt64, val)
+	val, err = CodecDecodeUvarint(SBytes("ff ff ff ff ff ff ff ff ff 01"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), val)
+	val, err = CodecDecodeUvarint(SBytes("80 80 80 80 80 80 80 80 80 02"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, twoTo64.Cmp(val.(*big.Int)))
+	_, err = CodecDecodeUvarint(SBytes("80 80"))
+	assert.Error(t, err)
+}
+
+// int64s go as they are, not narrowed to int (only 32 bits on some platforms).
+func TestBaseSvarint64(t *testing.T) {
+	assert.Equal(t, SBytes("03"), mustEnc(t, CodecEncodeSvarint, -2))
+	assert.Equal(t, SBytes("80 80 80 80 80 40"), mustEnc(t, CodecEncodeSvarint, int64(1<<40)))
+	assert.Equal(t, SBytes("ff ff ff ff ff ff ff ff ff 01"), mustEnc(t, CodecEncodeSvarint, int64(math.MinInt64)))
+	_, err := CodecEncodeSvarint(uint64(1))
+	assert.Error(t, err)
+
+	val, err := CodecDecodeSvarint(SBytes("80 80 80 80 80 40"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1<<40, val)
+
+	// same for the dynamic and reflect paths
+	buf, err := PackList([]interface{}{int64(1 << 40), int64(-1 << 40)})
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("47 06 80 80 80 80 80 20  48 06 ff ff ff ff ff 3f"), buf)
+	buf, err = Marshal(int64(1 << 40))
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("80 80 80 80 80 40"), buf)
+}
+
+// the Append versions give the same bytes as the Encode ones, after what's already there.
+func TestBaseAppend(t *testing.T) {
+	dst := SBytes("ff")
+	after := func(buf []byte) []byte { return append(SBytes("ff"), buf...) }
+
+	assert.Equal(t, after(SBytes("01 02")), AppendBytes(dst, []byte{1, 2}))
+	assert.Equal(t, after([]byte("hello")), AppendUtf8(dst, "hello"))
+	assert.Equal(t, after(SBytes("01")), AppendBool(dst, true))
+	assert.Equal(t, dst, AppendBool(dst, false))
+	assert.Equal(t, after(mustEnc(t, EncodeInt64, int64(-123456789))), AppendInt64(dst, -123456789))
+	assert.Equal(t, dst, AppendInt64(dst, 0))
+	assert.Equal(t, after(mustEnc(t, EncodeFloat64, 12345.6789)), AppendFloat64(dst, 12345.6789))
+	assert.Equal(t, after(mustEnc(t, EncodeComplex, complex(13.37, 42.42))), AppendComplex(dst, complex(13.37, 42.42)))
+
+	when := time.Unix(1600000000, 5)
+	buf, err := AppendStamp64(dst, when)
+	assert.Nil(t, err)
+	assert.Equal(t, after(mustEnc(t, EncodeStamp64, when)), buf)
+	buf, err = AppendStamp64(dst, time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.EqualError(t, err, "EncodeStamp64 time out of int64 nanosecond range")
+	assert.Equal(t, dst, buf)
+}
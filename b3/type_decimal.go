@@ -0,0 +1,262 @@
+package b3
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ DECIMAL - exact decimal numbers, coefficient * 10^exponent, for money and friends. python's decimal.Decimal.
+
+ [flags BYTE] [exponent magnitude UVARINT] [coefficient magnitude UVARINT]    <- finite numbers
+ [flags BYTE]                                                                 <- nan and infinity
+
+ --- flags byte ---
+ +------------+------------+------------+------------+------------+------------+------------+------------+
+ | -ve        | exp -ve    | infinity   | nan        | snan       | 0          | 0          | 0          |
+ +------------+------------+------------+------------+------------+------------+------------+------------+
+
+ The coefficient's uvarint is unbounded, the same as python ints, so it can be as big as we like.
+ python's -0 and -NaN have no go equivalent, they come in as 0 and NaN. A nan's diagnostic digits are skipped.
+*/
+
+const (
+	decimalNegative    = 0x80
+	decimalExpNegative = 0x40
+	decimalInfinity    = 0x20
+	decimalNaN         = 0x10
+	decimalSNaN        = 0x08
+)
+
+// Decimal is Coef * 10^Exp, exactly. A nil Coef means 0. Trailing zeros are kept, so 1.50 stays 1.50 (150, -2).
+// Form says if it's instead one of the special values python's Decimal has, then Coef and Exp aren't used.
+type Decimal struct {
+	Coef *big.Int
+	Exp  int
+	Form DecimalForm
+}
+
+type DecimalForm int
+
+const (
+	DecimalFinite DecimalForm = iota
+	DecimalInfinity
+	DecimalNegInfinity
+	DecimalNaN
+	DecimalSNaN // signalling NaN
+)
+
+// The special values' strings, the same as python's.
+var decimalFormStrings = map[DecimalForm]string{
+	DecimalInfinity:    "Infinity",
+	DecimalNegInfinity: "-Infinity",
+	DecimalNaN:         "NaN",
+	DecimalSNaN:        "sNaN",
+}
+
+func NewDecimal(coef *big.Int, exp int) Decimal {
+	return Decimal{Coef: new(big.Int).Set(coef), Exp: exp}
+}
+
+// ParseDecimal takes the same sort of strings python's Decimal() does, e.g. "-123.4500", "1E+3", "5e-7", "NaN",
+// "-Infinity".
+func ParseDecimal(s string) (Decimal, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, "+")) {
+	case "inf", "infinity":
+		return Decimal{Form: DecimalInfinity}, nil
+	case "-inf", "-infinity":
+		return Decimal{Form: DecimalNegInfinity}, nil
+	case "nan", "-nan":
+		return Decimal{Form: DecimalNaN}, nil
+	case "snan", "-snan":
+		return Decimal{Form: DecimalSNaN}, nil
+	}
+	mant, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Decimal{}, errors.Wrap(err, "ParseDecimal bad exponent")
+		}
+		mant, exp = s[:i], n
+	}
+	if i := strings.IndexByte(mant, '.'); i >= 0 {
+		exp -= len(mant) - i - 1
+		mant = mant[:i] + mant[i+1:]
+	}
+	if mant == "" || mant == "-" || mant == "+" || strings.ContainsAny(mant[1:], "+-") {
+		return Decimal{}, errors.New("ParseDecimal bad number")
+	}
+	coef, ok := new(big.Int).SetString(mant, 10)
+	if !ok {
+		return Decimal{}, errors.New("ParseDecimal bad number")
+	}
+	return Decimal{Coef: coef, Exp: exp}, nil
+}
+
+func (d Decimal) coef() *big.Int {
+	if d.Coef == nil {
+		return new(big.Int)
+	}
+	return d.Coef
+}
+
+// String follows python's str(Decimal) rules - plain notation when Exp <= 0 and the number isn't tiny,
+// scientific otherwise - so it parses back (here or in python) to the same Coef and Exp.
+func (d Decimal) String() string {
+	if d.Form != DecimalFinite {
+		return decimalFormStrings[d.Form]
+	}
+	coef := d.coef()
+	digits := new(big.Int).Abs(coef).String()
+	sign := ""
+	if coef.Sign() < 0 {
+		sign = "-"
+	}
+	adjusted := d.Exp + len(digits) - 1
+	if d.Exp > 0 || adjusted < -6 {
+		mant := digits[:1]
+		if len(digits) > 1 {
+			mant += "." + digits[1:]
+		}
+		expSign := "+"
+		if adjusted < 0 {
+			expSign = ""
+		}
+		return sign + mant + "E" + expSign + strconv.Itoa(adjusted)
+	}
+	if d.Exp == 0 {
+		return sign + digits
+	}
+	frac := -d.Exp
+	if len(digits) <= frac {
+		digits = strings.Repeat("0", frac-len(digits)+1) + digits
+	}
+	point := len(digits) - frac
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Rat returns the exact value, for doing arithmetic with. It's nil for NaNs and infinities.
+func (d Decimal) Rat() *big.Rat {
+	if d.Form != DecimalFinite {
+		return nil
+	}
+	r := new(big.Rat).SetInt(d.coef())
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(d.Exp))), nil)
+	if d.Exp >= 0 {
+		return r.Mul(r, new(big.Rat).SetInt(scale))
+	}
+	return r.Quo(r, new(big.Rat).SetInt(scale))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func EncodeDecimal(ifValue interface{}) ([]byte, error) {
+	var value Decimal
+	switch v := ifValue.(type) {
+	case Decimal:
+		value = v
+	case *Decimal:
+		if v == nil {
+			return nil, errors.New("EncodeDecimal input is nil")
+		}
+		value = *v
+	default:
+		return nil, errors.New("EncodeDecimal input not Decimal")
+	}
+
+	return AppendDecimal([]byte{}, value), nil
+}
+
+// AppendDecimal is EncodeDecimal appending to dst, see AppendUvarint64.
+func AppendDecimal(dst []byte, value Decimal) []byte {
+	switch value.Form {
+	case DecimalInfinity:
+		return append(dst, decimalInfinity)
+	case DecimalNegInfinity:
+		return append(dst, decimalInfinity|decimalNegative)
+	case DecimalNaN:
+		return append(dst, decimalNaN)
+	case DecimalSNaN:
+		return append(dst, decimalSNaN)
+	}
+
+	sign := 0 // not value.coef(), that allocates for a nil Coef
+	if value.Coef != nil {
+		sign = value.Coef.Sign()
+	}
+	if sign == 0 && value.Exp == 0 {
+		return dst // CZV
+	}
+	var flags byte
+	if sign < 0 {
+		flags |= decimalNegative
+	}
+	if value.Exp < 0 {
+		flags |= decimalExpNegative
+	}
+	dst = append(dst, flags)
+	dst = AppendUvarint64(dst, uint64(abs(value.Exp)))
+	switch {
+	case sign == 0:
+		return append(dst, 0)
+	case value.Coef.IsInt64() && value.Coef.Int64() != math.MinInt64:
+		return AppendUvarint64(dst, uint64(abs64(value.Coef.Int64())))
+	}
+	dst, _ = AppendUvarintBig(dst, new(big.Int).Abs(value.Coef)) // only errors on -ves
+	return dst
+}
+
+func abs64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func DecodeDecimal(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return Decimal{Coef: new(big.Int)}, nil
+	}
+	flags := buf[0]
+	if flags&0x07 != 0 {
+		return nil, errors.New("DecodeDecimal unknown flags")
+	}
+	switch {
+	case flags&decimalInfinity != 0 && flags&decimalNegative != 0:
+		return Decimal{Form: DecimalNegInfinity}, nil
+	case flags&decimalInfinity != 0:
+		return Decimal{Form: DecimalInfinity}, nil
+	case flags&decimalNaN != 0:
+		return Decimal{Form: DecimalNaN}, nil
+	case flags&decimalSNaN != 0:
+		return Decimal{Form: DecimalSNaN}, nil
+	}
+
+	exp, used, err := DecodeUvarint(buf[1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "DecodeDecimal exponent")
+	}
+	if flags&decimalExpNegative != 0 {
+		exp = -exp
+	}
+	coef, used2, err := DecodeUvarintBig(buf[1+used:])
+	if err != nil {
+		return nil, errors.Wrap(err, "DecodeDecimal coefficient")
+	}
+	if 1+used+used2 != len(buf) {
+		return nil, errors.New("DecodeDecimal trailing bytes")
+	}
+	if flags&decimalNegative != 0 {
+		coef.Neg(coef)
+	}
+	return Decimal{Coef: coef, Exp: exp}, nil
+}
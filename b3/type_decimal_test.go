@@ -0,0 +1,141 @@
+package b3
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustDecimal(t *testing.T, s string) Decimal {
+	d, err := ParseDecimal(s)
+	assert.Nil(t, err)
+	return d
+}
+
+func TestDecimalParse(t *testing.T) {
+	tests := []struct {
+		input string
+		coef  string
+		exp   int
+		str   string
+	}{
+		{"123.4500", "1234500", -4, "123.4500"},
+		{"-0.005", "-5", -3, "-0.005"},
+		{"1E+3", "1", 3, "1E+3"},
+		{"1.5e3", "15", 2, "1.5E+3"},
+		{"5e-6", "5", -6, "0.000005"},
+		{"5e-7", "5", -7, "5E-7"},
+		{"-12.5E-10", "-125", -11, "-1.25E-9"},
+		{"0", "0", 0, "0"},
+		{"0.00", "0", -2, "0.00"},
+		{"+42", "42", 0, "42"},
+	}
+	for _, test := range tests {
+		d := mustDecimal(t, test.input)
+		assert.Equal(t, test.coef, d.Coef.String())
+		assert.Equal(t, test.exp, d.Exp)
+		assert.Equal(t, test.str, d.String())
+	}
+	for _, bad := range []string{"", "-", "1.2.3", "1e", "abc", "1-2"} {
+		_, err := ParseDecimal(bad)
+		assert.Error(t, err, bad)
+	}
+	assert.Equal(t, "0", Decimal{}.String())
+
+	specials := []struct {
+		input string
+		form  DecimalForm
+		str   string
+	}{
+		{"NaN", DecimalNaN, "NaN"},
+		{"nan", DecimalNaN, "NaN"},
+		{"-NaN", DecimalNaN, "NaN"}, // no -NaN here, see type_decimal.go
+		{"sNaN", DecimalSNaN, "sNaN"},
+		{"Infinity", DecimalInfinity, "Infinity"},
+		{"+inf", DecimalInfinity, "Infinity"},
+		{"-Infinity", DecimalNegInfinity, "-Infinity"},
+	}
+	for _, test := range specials {
+		d := mustDecimal(t, test.input)
+		assert.Equal(t, test.form, d.Form, test.input)
+		assert.Equal(t, test.str, d.String(), test.input)
+	}
+}
+
+// NOTE: these vectors were worked out by hand from the python layout in type_decimal.go, not made by running the
+// python b3 package. Swap in ones it makes when it's to hand.
+
+func TestDecimalEnc(t *testing.T) {
+	tests := []struct {
+		input string
+		buf   []byte
+	}{
+		//                       flags  exp  coef
+		{"123.45", SBytes("40    02   b9 60")},
+		{"-123.45", SBytes("c0    02   b9 60")},
+		{"1E+3", SBytes("00    03   01")},
+		{"12345", SBytes("00    00   b9 60")},
+		{"0.00", SBytes("40    02   00")},
+		{"-0.005", SBytes("c0    03   05")},
+		{"1E-100", SBytes("40    64   01")},
+		{"18446744073709551616", SBytes("00 00 80 80 80 80 80 80 80 80 80 02")}, // 2^64, past uint64
+		{"0", SBytes("")},                                                       // compact zero-value
+		{"NaN", SBytes("10")},
+		{"sNaN", SBytes("08")},
+		{"Infinity", SBytes("20")},
+		{"-Infinity", SBytes("a0")},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.buf, mustEnc(t, EncodeDecimal, mustDecimal(t, test.input)), test.input)
+	}
+	_, err := EncodeDecimal(12.34)
+	assert.Error(t, err)
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	huge := "-123456789012345678901234567890123456789.000000000000000000000000000001"
+	for _, s := range []string{"123.4500", "-0.005", "1E+3", "7E+100", "1E-100", "0.00", "0", huge,
+		"NaN", "sNaN", "Infinity", "-Infinity"} {
+		d := mustDecimal(t, s)
+		val, err := DecodeDecimal(mustEnc(t, EncodeDecimal, d))
+		assert.Nil(t, err)
+		out := val.(Decimal)
+		assert.Equal(t, d.Exp, out.Exp, s)
+		assert.Equal(t, d.Form, out.Form, s)
+		assert.Equal(t, 0, d.coef().Cmp(out.coef()), s)
+		assert.Equal(t, s, out.String())
+	}
+}
+
+func TestDecimalDecErrors(t *testing.T) {
+	tests := []struct {
+		buf []byte
+		err string
+	}{
+		{SBytes("04 00 01"), "DecodeDecimal unknown flags"},
+		{SBytes("00 80"), "DecodeDecimal exponent: uvarint > buffer"},
+		{SBytes("00 02"), "DecodeDecimal coefficient: uvarint > buffer"},
+		{SBytes("00 02 01 01"), "DecodeDecimal trailing bytes"},
+	}
+	for _, test := range tests {
+		_, err := DecodeDecimal(test.buf)
+		assert.EqualError(t, err, test.err, "%x", test.buf)
+	}
+}
+
+func TestDecimalRat(t *testing.T) {
+	assert.Equal(t, big.NewRat(2469, 20), mustDecimal(t, "123.45").Rat())
+	assert.Equal(t, big.NewRat(1000, 1), mustDecimal(t, "1E+3").Rat())
+	assert.Nil(t, mustDecimal(t, "NaN").Rat())
+}
+
+func TestDecimalAppend(t *testing.T) {
+	for _, s := range []string{"0", "1.5", "-0.001", "1e10", "-123456789012345678901234567890", "-9223372036854775808", "-Infinity"} {
+		value := mustDecimal(t, s)
+		buf, err := EncodeDecimal(value)
+		assert.Nil(t, err)
+		assert.Equal(t, append(SBytes("ff"), buf...), AppendDecimal(SBytes("ff"), value), s)
+	}
+	assert.Equal(t, SBytes("ff"), AppendDecimal(SBytes("ff"), Decimal{}))
+}
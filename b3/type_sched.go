@@ -0,0 +1,233 @@
+package b3
+
+import (
+	"sync"
+	"time"
+	_ "time/tzdata" // so LoadLocation works for SCHED tznames on minimal containers with no zoneinfo installed.
+
+	"github.com/pkg/errors"
+)
+
+/*
+ SCHED - a calendar datetime, wall-clock plus the offset and/or zone name it was made in, python's datetime.
+ Unlike STAMP64 (an instant) this keeps "09:00 in Pacific/Auckland" as 09:00 in Pacific/Auckland.
+
+ [flags BYTE] [year SVARINT] [month BYTE] [day BYTE]      <- if has date
+              [hour BYTE] [minute BYTE] [second BYTE]     <- if has time
+              [sub-second UVARINT]                        <- if sub-second units aren't none
+              [offset seconds east of UTC SVARINT]        <- if has offset
+              [tzname len UVARINT] [tzname UTF8]          <- if has tzname
+
+ --- flags byte ---
+ +------------+------------+------------+------------+------------+------------+------------+------------+
+ | has date   | has time   | has offset | has tzname | 0          | 0          | sub-second units        |
+ +------------+------------+------------+------------+------------+------------+------------+------------+
+
+ sub-second units: 0 none, 1 milliseconds, 2 microseconds, 3 nanoseconds.
+
+ python datetimes stop at microseconds, so that's what we send - nanoseconds past the microsecond are dropped.
+ All three units decode.
+*/
+
+const (
+	schedHasDate    = 0x80
+	schedHasTime    = 0x40
+	schedHasOffset  = 0x20
+	schedHasTzname  = 0x10
+	schedSubsecMask = 0x03
+
+	schedSubsecMilli = 0x01
+	schedSubsecMicro = 0x02
+	schedSubsecNano  = 0x03
+)
+
+// Go times always have a date, a time and a Location, so the encoder always sends date+time+offset.
+// The tzname is only sent when the Location is a real IANA zone (one LoadLocation can find), because
+// "Local" and FixedZone abbreviations like "NZDT" mean nothing to the other side.
+
+func EncodeSched(ifValue interface{}) ([]byte, error) {
+	value, ok := ifValue.(time.Time)
+	if !ok {
+		return nil, errors.New("EncodeSched input not time.Time")
+	}
+	return AppendSched([]byte{}, value), nil
+}
+
+// AppendSched is EncodeSched appending to dst, see AppendUvarint64. Zone names are checked once each, see schedZoneName.
+func AppendSched(dst []byte, value time.Time) []byte {
+	if value.IsZero() {
+		return dst // CZV, same as Stamp64
+	}
+
+	flags := byte(schedHasDate | schedHasTime | schedHasOffset)
+	_, offset := value.Zone()
+	tzname := schedZoneName(value.Location())
+	if tzname != "" {
+		flags |= schedHasTzname
+	}
+	micro := value.Nanosecond() / 1000
+	if micro != 0 {
+		flags |= schedSubsecMicro
+	}
+
+	dst = append(dst, flags)
+	dst = AppendSvarint(dst, value.Year())
+	dst = append(dst, byte(value.Month()), byte(value.Day()))
+	dst = append(dst, byte(value.Hour()), byte(value.Minute()), byte(value.Second()))
+	if micro != 0 {
+		dst = AppendUvarint64(dst, uint64(micro))
+	}
+	dst = AppendSvarint(dst, offset)
+	if tzname != "" {
+		dst = AppendUvarint64(dst, uint64(len(tzname)))
+		dst = append(dst, tzname...)
+	}
+	return dst
+}
+
+// Whether zone names are ones LoadLocation knows, so it's only asked once per name. Names from decoded
+// FixedZones come from the other side, so the cache stops growing at schedZoneCacheMax, past which they're
+// just looked up every time.
+var schedZones = struct {
+	sync.RWMutex
+	known map[string]bool
+}{known: map[string]bool{}}
+
+const schedZoneCacheMax = 1000
+
+// UTC goes as just its offset, and "Local" is whatever this machine's zone is, which isn't a name for sending.
+func schedZoneName(loc *time.Location) string {
+	name := loc.String()
+	if name == "" || name == "UTC" || name == "Local" {
+		return ""
+	}
+	schedZones.RLock()
+	known, ok := schedZones.known[name]
+	schedZones.RUnlock()
+	if !ok {
+		_, err := time.LoadLocation(name)
+		known = err == nil
+		schedZones.Lock()
+		if len(schedZones.known) < schedZoneCacheMax {
+			schedZones.known[name] = known
+		}
+		schedZones.Unlock()
+	}
+	if !known {
+		return ""
+	}
+	return name
+}
+
+// Decoding: with a tzname we use the zone (falling back to a FixedZone with that name if we don't know it),
+// with just an offset we use a FixedZone, and with neither (python naive datetimes) we use UTC.
+// When both are present the offset pins the instant, so wall-clocks in a DST fold come back right.
+
+func DecodeSched(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return time.Time{}, nil
+	}
+	flags := buf[0]
+	index := 1
+	if flags&0x0c != 0 {
+		return nil, errors.New("DecodeSched unknown flags")
+	}
+
+	year, month, day := 1, 1, 1
+	hour, minute, second, nano := 0, 0, 0, 0
+	offset := 0
+	tzname := ""
+
+	if flags&schedHasDate != 0 {
+		n, used, err := DecodeSvarint(buf[index:])
+		if err != nil {
+			return nil, errors.Wrap(err, "DecodeSched year")
+		}
+		index += used
+		if len(buf) < index+2 {
+			return nil, errors.New("DecodeSched date > buffer")
+		}
+		year, month, day = n, int(buf[index]), int(buf[index+1])
+		index += 2
+		if month < 1 || month > 12 || day < 1 || time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+			return nil, errors.New("DecodeSched invalid date") // time.Date would quietly turn feb 31 into mar 3
+		}
+	}
+
+	if flags&schedHasTime != 0 {
+		if len(buf) < index+3 {
+			return nil, errors.New("DecodeSched time > buffer")
+		}
+		hour, minute, second = int(buf[index]), int(buf[index+1]), int(buf[index+2])
+		index += 3
+		if hour > 23 || minute > 59 || second > 59 {
+			return nil, errors.New("DecodeSched invalid time")
+		}
+	}
+
+	if units := flags & schedSubsecMask; units != 0 {
+		n, used, err := DecodeUvarint(buf[index:])
+		if err != nil {
+			return nil, errors.Wrap(err, "DecodeSched subsec")
+		}
+		scale := [4]int{schedSubsecMilli: 1000000, schedSubsecMicro: 1000, schedSubsecNano: 1}[units]
+		if n >= 1000000000/scale {
+			return nil, errors.New("DecodeSched invalid subsec")
+		}
+		nano = n * scale
+		index += used
+	}
+
+	if flags&schedHasOffset != 0 {
+		n, used, err := DecodeSvarint(buf[index:])
+		if err != nil {
+			return nil, errors.Wrap(err, "DecodeSched offset")
+		}
+		if n <= -86400 || n >= 86400 {
+			return nil, errors.New("DecodeSched invalid offset")
+		}
+		offset = n
+		index += used
+	}
+
+	if flags&schedHasTzname != 0 {
+		n, used, err := DecodeUvarint(buf[index:])
+		if err != nil {
+			return nil, errors.Wrap(err, "DecodeSched tzname len")
+		}
+		index += used
+		if n > len(buf)-index {
+			return nil, errors.New("DecodeSched tzname > buffer")
+		}
+		tzname = string(buf[index : index+n])
+		index += n
+	}
+
+	if index != len(buf) {
+		return nil, errors.New("DecodeSched trailing bytes")
+	}
+
+	hasOffset := flags&schedHasOffset != 0
+	var loc *time.Location
+	switch {
+	case tzname != "":
+		var err error
+		loc, err = time.LoadLocation(tzname)
+		if err != nil {
+			if !hasOffset {
+				return nil, errors.Wrap(err, "DecodeSched unknown tzname and no offset")
+			}
+			loc = time.FixedZone(tzname, offset)
+		}
+	case hasOffset && offset != 0:
+		loc = time.FixedZone("", offset)
+	default:
+		loc = time.UTC
+	}
+
+	if hasOffset {
+		fixed := time.FixedZone("", offset)
+		return time.Date(year, time.Month(month), day, hour, minute, second, nano, fixed).In(loc), nil
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, nano, loc), nil
+}
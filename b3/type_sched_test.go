@@ -0,0 +1,134 @@
+package b3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// NOTE: these vectors were worked out by hand from the python layout in type_sched.go, not made by running the
+// python b3 package. Swap in ones it makes when it's to hand.
+
+func TestSchedEnc(t *testing.T) {
+	tm := time.Date(2020, 10, 21, 9, 30, 15, 0, time.UTC)
+	//                       flags year  mo dy hr mi sc  offset
+	assert.Equal(t, SBytes("e0  c8 1f 0a 15 09 1e 0f 00"), mustEnc(t, EncodeSched, tm))
+
+	tm = time.Date(2020, 10, 21, 9, 30, 15, 500000, time.FixedZone("", -5*3600))
+	//                       flags year  mo dy hr mi sc  micro  offset (-18000)
+	assert.Equal(t, SBytes("e2  c8 1f 0a 15 09 1e 0f f4 03 9f 99 02"), mustEnc(t, EncodeSched, tm))
+
+	// microseconds, all a python datetime has, and a half hour offset. Past that is dropped.
+	tm = time.Date(2020, 10, 21, 9, 30, 15, 123456789, time.FixedZone("", 5*3600+1800))
+	//                       flags year  mo dy hr mi sc  micro     offset (19800)
+	assert.Equal(t, SBytes("e2  c8 1f 0a 15 09 1e 0f c0 c4 07 b0 b5 02"), mustEnc(t, EncodeSched, tm))
+	tm = time.Date(2020, 10, 21, 9, 30, 15, 999, time.UTC)
+	assert.Equal(t, SBytes("e0  c8 1f 0a 15 09 1e 0f 00"), mustEnc(t, EncodeSched, tm))
+
+	assert.Equal(t, SBytes(""), mustEnc(t, EncodeSched, time.Time{}))
+	_, err := EncodeSched("2020-10-21")
+	assert.Error(t, err)
+}
+
+func TestSchedTznameEnc(t *testing.T) {
+	loc, err := time.LoadLocation("Pacific/Auckland")
+	assert.Nil(t, err)
+	tm := time.Date(2020, 10, 21, 9, 30, 0, 0, loc) // NZDT, +13:00
+	//                  flags year  mo dy hr mi sc  offset(46800) len  "Pacific/Auckland"
+	exBuf := SBytes("f0  c8 1f 0a 15 09 1e 00 a0 db 05 10 50 61 63 69 66 69 63 2f 41 75 63 6b 6c 61 6e 64")
+	assert.Equal(t, exBuf, mustEnc(t, EncodeSched, tm))
+
+	// IANA names don't all have a /
+	loc, err = time.LoadLocation("Japan")
+	assert.Nil(t, err)
+	tm = time.Date(2020, 10, 21, 9, 30, 0, 0, loc)
+	//              flags year  mo dy hr mi sc  offset(32400) len  "Japan"
+	exBuf = SBytes("f0  c8 1f 0a 15 09 1e 00 a0 fa 03 05 4a 61 70 61 6e")
+	assert.Equal(t, exBuf, mustEnc(t, EncodeSched, tm))
+	assert.Equal(t, exBuf, mustEnc(t, EncodeSched, tm)) // again, from the cache
+
+	// made up abbreviations aren't sent
+	tm = time.Date(2020, 10, 21, 9, 30, 0, 0, time.FixedZone("NZDT", 13*3600))
+	assert.Equal(t, SBytes("e0 c8 1f 0a 15 09 1e 00 a0 db 05"), mustEnc(t, EncodeSched, tm))
+}
+
+func TestSchedRoundTrip(t *testing.T) {
+	auck, _ := time.LoadLocation("Pacific/Auckland")
+	ny, _ := time.LoadLocation("America/New_York")
+	tests := []time.Time{
+		time.Date(2020, 10, 21, 9, 30, 15, 0, time.UTC),
+		time.Date(2020, 10, 21, 9, 30, 15, 123456000, time.FixedZone("", 5*3600+1800)),
+		time.Date(2021, 4, 4, 2, 30, 0, 0, auck).Add(time.Hour), // in the DST fold, 2:30 happens twice
+		time.Date(1850, 2, 28, 23, 59, 59, 1000, ny),            // LMT, offset isn't whole minutes
+		time.Date(-44, 3, 15, 12, 0, 0, 0, time.UTC),            // -ve years
+	}
+	for _, tm := range tests {
+		val, err := DecodeSched(mustEnc(t, EncodeSched, tm))
+		assert.Nil(t, err)
+		out := val.(time.Time)
+		assert.True(t, tm.Equal(out), "instant %v vs %v", tm, out)
+		assert.Equal(t, tm.Location().String(), out.Location().String())
+		assert.Equal(t, tm.String(), out.String()) // same wall clock & zone
+	}
+}
+
+func TestSchedDec(t *testing.T) {
+	// python naive datetime - no offset or tzname, comes back as UTC
+	val, err := DecodeSched(SBytes("c0 c8 1f 0a 15 09 1e 0f"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 21, 9, 30, 15, 0, time.UTC), val)
+
+	// date only
+	val, err = DecodeSched(SBytes("80 c8 1f 0a 15"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 21, 0, 0, 0, 0, time.UTC), val)
+
+	// tzname we dont know, with offset - falls back to a fixed zone with that name
+	val, err = DecodeSched(SBytes("f0 c8 1f 0a 15 09 1e 00 a0 db 05 03 46 6f 6f"))
+	assert.Nil(t, err)
+	name, offset := val.(time.Time).Zone()
+	assert.Equal(t, "Foo", name)
+	assert.Equal(t, 46800, offset)
+
+	// all the sub-second units python might send
+	val, err = DecodeSched(SBytes("c1 c8 1f 0a 15 09 1e 0f f4 03"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 21, 9, 30, 15, 500000000, time.UTC), val)
+	val, err = DecodeSched(SBytes("c2 c8 1f 0a 15 09 1e 0f f4 03"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 21, 9, 30, 15, 500000, time.UTC), val)
+	val, err = DecodeSched(SBytes("c3 c8 1f 0a 15 09 1e 0f f4 03"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 10, 21, 9, 30, 15, 500, time.UTC), val)
+
+	val, err = DecodeSched(SBytes(""))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Time{}, val)
+}
+
+func TestSchedDecErrors(t *testing.T) {
+	tests := [][]byte{
+		SBytes("c4 c8 1f 0a 15 09 1e 0f"),             // unknown flag bits
+		SBytes("c1 c8 1f 0a 15 09 1e 0f e8 07"),       // 1000 milliseconds
+		SBytes("c0 c8 1f 0a"),                         // date > buffer
+		SBytes("c0 c8 1f 0a 15 09 1e"),                // time > buffer
+		SBytes("c0 c8 1f 02 1f 09 1e 0f"),             // feb 31
+		SBytes("c0 c8 1f 0a 15 18 1e 0f"),             // hour 24
+		SBytes("c0 c8 1f 0a 15 09 1e 0f 00"),          // trailing bytes
+		SBytes("d0 c8 1f 0a 15 09 1e 0f 03 46 6f 6f"), // unknown tzname, no offset to fall back on
+		SBytes("d0 c8 1f 0a 15 09 1e 0f 09 46 6f 6f"), // tzname > buffer
+	}
+	for _, test := range tests {
+		_, err := DecodeSched(test)
+		assert.Error(t, err, "%x", test)
+	}
+}
+
+func TestSchedAppend(t *testing.T) {
+	when := time.Date(2021, 3, 4, 5, 6, 7, 8000, time.FixedZone("", 3600))
+	buf, err := EncodeSched(when)
+	assert.Nil(t, err)
+	assert.Equal(t, append(SBytes("ff"), buf...), AppendSched(SBytes("ff"), when))
+	assert.Equal(t, SBytes("ff"), AppendSched(SBytes("ff"), time.Time{}))
+}
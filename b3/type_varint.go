@@ -2,35 +2,91 @@ package b3
 
 import (
 	"fmt"
+	"math/big"
 )
 
-
 // ===== Encoding =========
 
 // Policy: Not enough buffer isn't an error because we're append() ing
 
-func EncodeUvarint(x int) []byte  {				// todo: figure out about uints vs ints coming in here.
-	var out []byte
+// Ints are 32 bits on some platforms, so decoding into one checks against this rather than MaxInt64.
+const maxInt = int(^uint(0) >> 1)
+
+// EncodeUvarint errors on -ves, which have no uvarint.
+func EncodeUvarint(x int) ([]byte, error) {
+	return AppendUvarint(nil, x)
+}
+
+func EncodeUvarint64(x uint64) []byte {
+	return AppendUvarint64(nil, x)
+}
+
+// The wire format is unbounded, so anything bigger than a uint64 goes via big.Int.
+func EncodeUvarintBig(x *big.Int) ([]byte, error) {
+	return AppendUvarintBig(nil, x)
+}
+
+func EncodeSvarint(x int) []byte {
+	return AppendSvarint(nil, x)
+}
+
+// The Append versions add to the end of dst and return it, like strconv.AppendInt, so a caller that keeps
+// reusing one buffer doesn't allocate. The Encode versions above are these with a nil dst.
+
+// AppendUvarint errors on -ves like EncodeUvarint, with dst as it was.
+func AppendUvarint(dst []byte, x int) ([]byte, error) {
+	if x < 0 {
+		return dst, fmt.Errorf("uvarint < 0")
+	}
+	return AppendUvarint64(dst, uint64(x)), nil
+}
+
+// For header lengths, type numbers and keys, and other ints that can't be -ve. Callers check first (AppendHeader
+// errors on -ve data types and keys), a -ve x here would come out as a huge number.
+func appendUvarint(dst []byte, x int) []byte {
+	return AppendUvarint64(dst, uint64(x))
+}
+
+func AppendUvarint64(dst []byte, x uint64) []byte {
 	for x >= 0x80 {
-		out = append(out, byte(x)|0x80)
+		dst = append(dst, byte(x)|0x80)
 		x >>= 7
 	}
-	out = append(out,byte(x))
-	return out
+	return append(dst, byte(x))
+}
+
+func AppendUvarintBig(dst []byte, x *big.Int) ([]byte, error) {
+	if x.Sign() < 0 {
+		return dst, fmt.Errorf("uvarint < 0")
+	}
+	if x.IsUint64() {
+		return AppendUvarint64(dst, x.Uint64()), nil
+	}
+	n := new(big.Int).Set(x)
+	low := new(big.Int)
+	mask := big.NewInt(0x7f)
+	for n.BitLen() > 7 {
+		dst = append(dst, byte(low.And(n, mask).Uint64())|0x80)
+		n.Rsh(n, 7)
+	}
+	return append(dst, byte(n.Uint64())), nil
+}
+
+func AppendSvarint(dst []byte, x int) []byte {
+	return AppendSvarint64(dst, int64(x))
 }
 
-func EncodeSvarint(x int)  []byte {
+// The 64 versions are for int64s, which don't fit an int on 32 bit platforms.
+func AppendSvarint64(dst []byte, x int64) []byte {
 	ux := uint64(x) << 1
 	if x < 0 {
 		ux = ^ux
 	}
-	return EncodeUvarint(int(ux))
+	return AppendUvarint64(dst, ux)
 }
 
-
 // ========= Decoding ==========
 
-
 // Policy: indexes are ints now because thats what for:=range shits out.
 
 // --- Decoding into fixed-size numeric variables and pre-checking to stave off overflow panics. ---
@@ -43,50 +99,89 @@ func EncodeSvarint(x int)  []byte {
 // (2^63)    =   9_223_372_036_854_775_808  =  \x80\x80\x80\x80\x80\x80\x80\x80\x80\x01
 // ... its when i goes from 8 to 9.
 
-
 // Policy: NEW: DecodeUvarint and friends do NOT take an incoming index. top-down slices for us, so we always
 //         start at the start of the slice we are given.
 // Policy: NEW: we DO however, have to return the number of bytes consumed.
 // Note: the number of bytes consumed is NOT an index!
 
-
 func DecodeUvarint(buf []byte) (int, int, error) { // returns output,bytes-consumed,error
-	var result int
-	var shift int
+	var result uint64
+	var shift uint
 	for i, byt := range buf {
 		if byt < 0x80 { // MSbit clear, final byte.
 			if i >= 9 {
 				return 0, 0, fmt.Errorf("uvarint > int64")
 			}
-			return result | int(byt)<<shift, i + 1, nil // Ok
+			result |= uint64(byt) << shift
+			if result > uint64(maxInt) {
+				return 0, 0, fmt.Errorf("uvarint > int") // only on 32 bit platforms
+			}
+			return int(result), i + 1, nil // Ok
 		}
-		result |= int(byt&0x7f) << shift
+		result |= uint64(byt&0x7f) << shift
 		shift += 7
 	}
 	return 0, 0, fmt.Errorf("uvarint > buffer")
 }
 
+func DecodeUvarint64(buf []byte) (uint64, int, error) { // returns output,bytes-consumed,error
+	var result uint64
+	var shift uint
+	for i, byt := range buf {
+		if byt < 0x80 { // MSbit clear, final byte.
+			if i > 9 || i == 9 && byt > 1 {
+				return 0, 0, fmt.Errorf("uvarint > uint64")
+			}
+			return result | uint64(byt)<<shift, i + 1, nil // Ok
+		}
+		if i >= 9 {
+			return 0, 0, fmt.Errorf("uvarint > uint64") // dont wait for the final byte, it might never come.
+		}
+		result |= uint64(byt&0x7f) << shift
+		shift += 7
+	}
+	return 0, 0, fmt.Errorf("uvarint > buffer")
+}
+
+func DecodeUvarintBig(buf []byte) (*big.Int, int, error) { // returns output,bytes-consumed,error
+	result := new(big.Int)
+	digit := new(big.Int)
+	var shift uint
+	for i, byt := range buf {
+		digit.SetUint64(uint64(byt & 0x7f))
+		result.Or(result, digit.Lsh(digit, shift))
+		if byt < 0x80 {
+			return result, i + 1, nil
+		}
+		shift += 7
+	}
+	return nil, 0, fmt.Errorf("uvarint > buffer")
+}
+
 func DecodeSvarint(buf []byte) (int, int, error) { // returns output,bytes-consumed,error
-	ux, bytesConsumed, err := DecodeUvarint(buf)
+	result, bytesConsumed, err := DecodeSvarint64(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if result > int64(maxInt) || result < -int64(maxInt)-1 {
+		return 0, 0, fmt.Errorf("svarint > int") // only on 32 bit platforms
+	}
+	return int(result), bytesConsumed, nil
+}
+
+func DecodeSvarint64(buf []byte) (int64, int, error) {
+	ux, bytesConsumed, err := DecodeUvarint64(buf) // 64 because zig-zag uses the whole uint64 for int64s
 	if err != nil {
 		return 0, 0, err
 	}
 
-	result := int(ux >> 1)
+	result := int64(ux >> 1)
 	if ux&1 != 0 {
 		result = ^result
 	}
 	return result, bytesConsumed, nil
 }
 
-
-
-
-
-
-
-
-
 // ==== this might be old/invalid now? ====
 
 // In python we use buf,index and return value,index
@@ -115,9 +210,7 @@ func DecodeSvarint(buf []byte) (int, int, error) { // returns output,bytes-consu
 // for our quick hack, we're targetting decode into struct.
 // if the struct members are smaller than uint64 then we will have to deal with overflow errors.
 
-
 // Because not panicing means we can do stuff like have the highest level do things like disconnect the socket.
 
-
 // The varints are self-sizing for the item header, so we DO have to do the buf,index thing.
 // but for the CODECS, we can go the "simple buf" way.
@@ -2,6 +2,8 @@ package b3
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"math/bits"
 	"testing"
 
@@ -21,14 +23,18 @@ func TestUvarintEncode(t *testing.T) {
 		{0, SBytes("00")},
 	}
 	for _, test := range tests {
-		assert.Equal(t, test.expected, EncodeUvarint(test.input))
+		buf, err := EncodeUvarint(test.input)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, buf)
 	}
+	_, err := EncodeUvarint(-1)
+	assert.EqualError(t, err, "uvarint < 0")
 }
 
 // There is bits.UintSize (in bits), and unsafe.Sizeof() (in bytes)
 
 func TestEnsure64Bit(t *testing.T) {
-	assert.Equal(t, 64, bits.UintSize, "!!! Remember to set GOARCH=amd64 !!!")				// we can use math/bits
+	assert.Equal(t, 64, bits.UintSize, "!!! Remember to set GOARCH=amd64 !!!") // we can use math/bits
 	// var y int
 	// assert.Equal(t, 8, int(unsafe.Sizeof(y)), "!!! Remember to set GOARCH=amd64 !!!")	// or unsafe.Sizeof
 }
@@ -36,15 +42,15 @@ func TestEnsure64Bit(t *testing.T) {
 func TestUvarintDecode(t *testing.T) {
 	var tests = []struct {
 		input []byte
-		val   int    // setting type here makes it work. testify isn't good with
-		index int    // untyped contants it seems.
+		val   int // setting type here makes it work. testify isn't good with
+		index int // untyped contants it seems.
 		err   error
 	}{
 		{SBytes("32"), 50, 1, nil},
 		{SBytes("f4 03"), 500, 2, nil},
 		{SBytes("d0 86 03"), 50000, 3, nil},
 		{SBytes("d0 86 83"), 0, 0, fmt.Errorf("uvarint > buffer")},
-		{SBytes("ff ff ff ff ff ff ff ff 7f"),    9_223_372_036_854_775_807, 9, nil},
+		{SBytes("ff ff ff ff ff ff ff ff 7f"), 9_223_372_036_854_775_807, 9, nil},
 		{SBytes("80 80 80 80 80 80 80 80 80 01"), 0, 0, fmt.Errorf("uvarint > int64")},
 		// {SBytes("ff ff ff ff ff ff ff ff ff 01"), 18_446_744_073_709_551_615, 10, nil},	// todo: only if we go back to uint64
 		// {SBytes("80 80 80 80 80 80 80 80 80 02"), 0, 0, fmt.Errorf("uvarint > uint64")}, // todo: only if we go back to uint64
@@ -58,7 +64,6 @@ func TestUvarintDecode(t *testing.T) {
 	}
 }
 
-
 func TestSvarintEncode(t *testing.T) {
 	tests := []struct {
 		input    int
@@ -77,8 +82,8 @@ func TestSvarintEncode(t *testing.T) {
 func TestSvarintDecode(t *testing.T) {
 	var tests = []struct {
 		input []byte
-		val   int    // setting type here makes it work. testify isn't good with go's normal somewhat-untyped constants
-		index int    // untyped contants it seems.
+		val   int // setting type here makes it work. testify isn't good with go's normal somewhat-untyped constants
+		index int // untyped contants it seems.
 		err   error
 	}{
 		{SBytes("64"), 50, 1, nil},
@@ -97,5 +102,98 @@ func TestSvarintDecode(t *testing.T) {
 	}
 }
 
+func TestUvarint64(t *testing.T) {
+	var tests = []struct {
+		input []byte
+		val   uint64
+		index int
+		err   error
+	}{
+		{SBytes("32"), 50, 1, nil},
+		{SBytes("ff ff ff ff ff ff ff ff 7f"), 9_223_372_036_854_775_807, 9, nil},
+		{SBytes("80 80 80 80 80 80 80 80 80 01"), 9_223_372_036_854_775_808, 10, nil},
+		{SBytes("ff ff ff ff ff ff ff ff ff 01"), 18_446_744_073_709_551_615, 10, nil},
+		{SBytes("80 80 80 80 80 80 80 80 80 02"), 0, 0, fmt.Errorf("uvarint > uint64")},
+		{SBytes("80 80 80 80 80 80 80 80 80 80 01"), 0, 0, fmt.Errorf("uvarint > uint64")},
+		{SBytes("d0 86 83"), 0, 0, fmt.Errorf("uvarint > buffer")},
+	}
+	for _, test := range tests {
+		val, index, err := DecodeUvarint64(test.input)
+		assert.Equal(t, test.err, err)
+		assert.Equal(t, test.index, index)
+		assert.Equal(t, test.val, val)
+		if err == nil {
+			assert.Equal(t, test.input, EncodeUvarint64(test.val))
+		}
+	}
+}
 
+func TestUvarintBig(t *testing.T) {
+	twoTo64, _ := new(big.Int).SetString("18446744073709551616", 10)
+	twoTo100, _ := new(big.Int).SetString("1267650600228229401496703205376", 10)
+	tests := []struct {
+		val *big.Int
+		buf []byte
+	}{
+		{big.NewInt(0), SBytes("00")},
+		{big.NewInt(500), SBytes("f4 03")},
+		{twoTo64, SBytes("80 80 80 80 80 80 80 80 80 02")},
+		{twoTo100, SBytes("80 80 80 80 80 80 80 80 80 80 80 80 80 80 04")},
+	}
+	for _, test := range tests {
+		buf, err := EncodeUvarintBig(test.val)
+		assert.Nil(t, err)
+		assert.Equal(t, test.buf, buf)
+		val, index, err := DecodeUvarintBig(test.buf)
+		assert.Nil(t, err)
+		assert.Equal(t, len(test.buf), index)
+		assert.Equal(t, 0, test.val.Cmp(val))
+	}
+	_, err := EncodeUvarintBig(big.NewInt(-1))
+	assert.Equal(t, fmt.Errorf("uvarint < 0"), err)
+	_, _, err = DecodeUvarintBig(SBytes("80 80"))
+	assert.Equal(t, fmt.Errorf("uvarint > buffer"), err)
+}
 
+func TestSvarintFullRange(t *testing.T) {
+	for _, x := range []int{math.MaxInt64, math.MinInt64, math.MinInt64 + 1} {
+		buf := EncodeSvarint(x)
+		assert.Equal(t, 10, len(buf))
+		val, index, err := DecodeSvarint(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, index)
+		assert.Equal(t, x, val)
+	}
+	assert.Equal(t, SBytes("ff ff ff ff ff ff ff ff ff 01"), EncodeSvarint(math.MinInt64))
+
+	// the 64 versions, for int64s on any platform
+	for _, x := range []int64{math.MaxInt64, math.MinInt64, 1 << 40, -1 << 40} {
+		val, index, err := DecodeSvarint64(AppendSvarint64(nil, x))
+		assert.Nil(t, err)
+		assert.Equal(t, x, val)
+		assert.Equal(t, len(AppendSvarint64(nil, x)), index)
+	}
+	assert.Equal(t, SBytes("ff ff ff ff ff ff ff ff ff 01"), AppendSvarint64(nil, math.MinInt64))
+}
+
+func TestAppendVarints(t *testing.T) {
+	dst := SBytes("ff")
+	assert.Equal(t, SBytes("ff 96 01"), appendUvarint(dst, 150))
+	assert.Equal(t, SBytes("ff ff ff ff ff ff ff ff ff ff 01"), AppendUvarint64(dst, math.MaxUint64))
+	assert.Equal(t, SBytes("ff 03"), AppendSvarint(dst, -2))
+	assert.Equal(t, SBytes("ff 00"), appendUvarint(dst, 0))
+	buf, err := AppendUvarint(dst, 150)
+	assert.Nil(t, err)
+	assert.Equal(t, SBytes("ff 96 01"), buf)
+	buf, err = AppendUvarint(dst, -1)
+	assert.EqualError(t, err, "uvarint < 0")
+	assert.Equal(t, SBytes("ff"), buf)
+	big1 := new(big.Int).Lsh(big.NewInt(1), 70)
+	want, err := EncodeUvarintBig(big1)
+	assert.Nil(t, err)
+	buf, err = AppendUvarintBig(dst, big1)
+	assert.Nil(t, err)
+	assert.Equal(t, append(SBytes("ff"), want...), buf)
+	_, err = AppendUvarintBig(dst, big.NewInt(-1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oddy/b3-go/internal/b3tag"
+	"github.com/pkg/errors"
+)
+
+// The generated code mirrors the reflect path in the b3 package (appendStruct/appendValue on the way out,
+// fillStruct/decodeValue on the way in), so the bytes come out the same. Where the reflect path leans on a
+// helper, the generated code calls the b3.Gen* one that does the same thing.
+
+type generator struct {
+	pkg   *pkgInfo
+	buf   bytes.Buffer
+	quals map[string]bool // package names the generated code uses
+	n     int             // for unique variable names
+}
+
+// generate returns the formatted source for the types' methods, and the file name it should go in.
+func generate(dir string, typeNames []string) ([]byte, string, error) {
+	for i := range typeNames {
+		typeNames[i] = strings.TrimSpace(typeNames[i])
+	}
+	pkg, err := loadPackage(dir, typeNames)
+	if err != nil {
+		return nil, "", err
+	}
+	g := &generator{pkg: pkg, quals: map[string]bool{}}
+	test := false
+	for _, name := range typeNames {
+		s, err := pkg.structFor(name)
+		if err != nil {
+			return nil, "", err
+		}
+		test = test || pkg.types[name].test
+		g.marshal(s)
+		g.unmarshal(s)
+		g.p("// B3Generated marks %s as having b3gen'd methods, see b3.B3Generated.", s.name)
+		g.p("func (%s) B3Generated() {}", s.name)
+		g.p("")
+	}
+
+	src, err := format.Source(g.file())
+	if err != nil {
+		return nil, "", errors.Wrap(err, "formatting generated code")
+	}
+	name := strings.ToLower(typeNames[0]) + "_b3.go"
+	if test {
+		name = strings.ToLower(typeNames[0]) + "_b3_test.go"
+	}
+	return src, name, nil
+}
+
+func (g *generator) file() []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by b3gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg.name)
+	imports := map[string]string{"b3": b3Path}
+	for qual := range g.quals {
+		for _, decl := range g.pkg.types {
+			if importPath, ok := decl.imports[qual]; ok {
+				imports[qual] = importPath
+			}
+		}
+	}
+	// standard library first, then the rest, like goimports.
+	var std, other []string
+	for name, importPath := range imports {
+		spec := strconv.Quote(importPath)
+		if name != path.Base(importPath) {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(importPath, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	if len(std) > 0 {
+		fmt.Fprintf(&out, "\t%s\n\n", strings.Join(std, "\n\t"))
+	}
+	fmt.Fprintf(&out, "\t%s\n)\n\n", strings.Join(other, "\n\t"))
+	out.Write(g.buf.Bytes())
+	return out.Bytes()
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+// The type's source text, noting the packages it needs.
+func (g *generator) typeText(t *goType) string {
+	for _, qual := range t.quals {
+		g.quals[qual] = true
+	}
+	return t.text
+}
+
+func (g *generator) next() int {
+	g.n++
+	return g.n
+}
+
+// ===================== Encoding ===========================
+
+func (g *generator) marshal(s *genStruct) {
+	g.p("// AppendB3 appends a %s's CompositeDict data to dst, the same as b3.AppendStruct does.", s.name)
+	g.p("func (v %s) AppendB3(dst []byte) ([]byte, error) {", s.name)
+	g.p("orig := len(dst) // dst goes back as it was on errors")
+	g.p("var dt, start int")
+	g.p("var isNull bool")
+	g.p("var err error")
+	for _, f := range s.fields {
+		x := "v." + f.name
+		wrap := fieldWrap(f.name)
+		g.p("")
+		if f.OmitEmpty {
+			g.p("if %s {", g.nonZero(f.t, x))
+		}
+		g.p("start = len(dst)")
+		switch {
+		case f.t.kind == pointerKind && f.OmitEmpty: // nil is left out
+			g.encode(f.t.elem, "*"+x, wrap)
+		case f.t.kind == pointerKind && f.NullZero:
+			g.p("if %s == nil {", x)
+			g.encode(f.t.elem, "*new("+g.typeText(f.t.elem)+")", wrap) // the zero value instead of a null
+			g.p("} else {")
+			g.encode(f.t.elem, "*"+x, wrap)
+			g.p("}")
+		default:
+			g.encode(f.t, x, wrap)
+		}
+		g.p("if dst, err = b3.GenInsertHeader(dst, start, b3.ItemHeader{DataType: dt, Key: %s, IsNull: isNull}); err != nil {", itemKey(f))
+		g.p("return dst[:orig], %s", wrapErr(wrap, "err"))
+		g.p("}")
+		if f.OmitEmpty {
+			g.p("}")
+		}
+	}
+	g.p("return dst, nil")
+	g.p("}")
+	g.p("")
+	g.p("// MarshalB3 encodes a %s as CompositeDict data, the same as b3.StructToBuf does.", s.name)
+	g.p("func (v %s) MarshalB3() (int, []byte, error) {", s.name)
+	g.p("data, err := v.AppendB3(make([]byte, 0))")
+	g.p("if err != nil {")
+	g.p("return 0, nil, err")
+	g.p("}")
+	g.p("return b3.B3_COMPOSITE_DICT, data, nil")
+	g.p("}")
+	g.p("")
+}
+
+// The item key StructToBuf uses by default - the tag number, or the key if there isn't one.
+func itemKey(f genField) string {
+	if f.HasTag {
+		return strconv.Itoa(f.Tag)
+	}
+	return strconv.Quote(f.Key)
+}
+
+// Code to append the value x's data to dst, and set dt and isNull for its header. wrap names where x is for
+// its errors, see fieldWrap.
+func (g *generator) encode(t *goType, x string, wrap string) {
+	switch t.kind {
+	case scalarKind:
+		g.p("dt, isNull = b3.B3_%s, false", t.dt)
+		if call, canFail := g.appendCall(t, x); canFail {
+			g.p("if dst, err = %s; err != nil {", call)
+			g.p("return dst[:orig], %s", wrapErr(wrap, "err"))
+			g.p("}")
+		} else {
+			g.p("dst = %s", call)
+		}
+
+	case marshalerKind:
+		g.p("if dst, dt, isNull, err = b3.GenAppend(dst, %s); err != nil {", addr(x))
+		g.p("return dst[:orig], %s", wrapErr(wrap, "err"))
+		g.p("}")
+
+	case pointerKind:
+		g.p("if %s == nil {", x)
+		g.p("dt, isNull = %s, true", g.nullDataType(t.elem, x))
+		g.p("} else {")
+		g.encode(t.elem, "*"+x, wrap)
+		g.p("}")
+
+	case sliceKind:
+		n := g.next()
+		i, start := fmt.Sprintf("i%d", n), fmt.Sprintf("start%d", n)
+		elemWrap := indexWrap(wrap, i)
+		g.p("for %s := range %s {", i, x)
+		g.p("%s := len(dst)", start)
+		g.encode(t.elem, index(x, i), elemWrap)
+		g.p("if dst, err = b3.GenInsertHeader(dst, %s, b3.ItemHeader{DataType: dt, IsNull: isNull}); err != nil {", start)
+		g.p("return dst[:orig], %s", wrapErr(elemWrap, "err"))
+		g.p("}")
+		g.p("}")
+		g.p("dt, isNull = b3.B3_COMPOSITE_LIST, false")
+	}
+}
+
+// The call appending x's data to dst with its codec, and whether it returns an error too.
+func (g *generator) appendCall(t *goType, x string) (string, bool) {
+	switch t.class {
+	case "int":
+		return fmt.Sprintf("b3.GenAppendInt(dst, b3.B3_%s, %s)", t.dt, convert(t, "int64", x)), true
+	case "uint":
+		return fmt.Sprintf("b3.GenAppendUint(dst, b3.B3_%s, %s)", t.dt, convert(t, "uint64", x)), true
+	case "float":
+		return fmt.Sprintf("b3.AppendFloat64(dst, %s)", convert(t, "float64", x)), false
+	case "complex":
+		return fmt.Sprintf("b3.AppendComplex(dst, %s)", convert(t, "complex128", x)), false
+	case "bool":
+		return fmt.Sprintf("b3.AppendBool(dst, %s)", convert(t, "bool", x)), false
+	case "string":
+		return fmt.Sprintf("b3.AppendUtf8(dst, %s)", convert(t, "string", x)), false
+	case "bytes":
+		return fmt.Sprintf("b3.AppendBytes(dst, %s)", convert(t, "[]byte", x)), false
+	case "time":
+		if t.dt == "SCHED" {
+			return fmt.Sprintf("b3.AppendSched(dst, %s)", x), false
+		}
+		return fmt.Sprintf("b3.AppendStamp64(dst, %s)", x), true
+	}
+	return fmt.Sprintf("b3.AppendDecimal(dst, %s)", x), false
+}
+
+// The data type of the null item for a nil pointer to t, see the b3 package's nullDataType.
+func (g *generator) nullDataType(t *goType, ptr string) string {
+	switch t.kind {
+	case scalarKind:
+		return "b3.B3_" + t.dt
+	case sliceKind:
+		return "b3.B3_COMPOSITE_LIST"
+	}
+	dt := "0"
+	if _, builtin := b3tag.Builtin(t.dt); builtin {
+		dt = "b3.B3_" + t.dt
+	}
+	return fmt.Sprintf("b3.GenNullDataType(%s, %s)", ptr, dt)
+}
+
+// The go test for omitempty, matching reflect's IsZero.
+func (g *generator) nonZero(t *goType, x string) string {
+	switch {
+	case t.kind != scalarKind, t.class == "bytes":
+		return x + " != nil"
+	case t.class == "bool":
+		return x
+	case t.class == "string":
+		return x + ` != ""`
+	case t.class == "time", t.class == "decimal":
+		return fmt.Sprintf("%s != (%s{})", x, g.typeText(t))
+	}
+	return x + " != 0"
+}
+
+// ===================== Decoding ===========================
+
+func (g *generator) unmarshal(s *genStruct) {
+	var required []genField
+	for _, f := range s.fields {
+		if f.Required {
+			required = append(required, f)
+		}
+	}
+
+	g.p("// UnmarshalB3 decodes CompositeDict data into a %s, the same as b3.BufToStruct does.", s.name)
+	g.p("func (v *%s) UnmarshalB3(dataType int, data []byte) error {", s.name)
+	g.p("if err := b3.GenCheckType(dataType, b3.B3_COMPOSITE_DICT); err != nil {")
+	g.p("return err")
+	g.p("}")
+	if len(required) > 0 {
+		g.p("var seen [%d]bool // required fields", len(required))
+	}
+	g.p("for index := 0; index < len(data); {")
+	g.p("hdr, used, err := b3.DecodeHeader(data[index:])")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("index += used")
+	g.p("item, err := b3.GenItemData(data[index:], hdr)")
+	g.p("if err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("index += hdr.DataLen")
+	g.p("")
+	g.p("switch hdr.Key {")
+	for _, f := range s.fields {
+		var keys []string
+		if f.HasTag {
+			keys = append(keys, strconv.Itoa(f.Tag))
+		}
+		if f.Key != "" {
+			keys = append(keys, strconv.Quote(f.Key))
+		}
+		g.p("case %s:", strings.Join(keys, ", "))
+		for i, r := range required {
+			if r.name == f.name {
+				g.p("seen[%d] = true", i)
+			}
+		}
+		x := "v." + f.name
+		if f.NullZero {
+			g.p("if hdr.IsNull {")
+			if f.t.kind == pointerKind {
+				g.p("%s = new(%s)", x, g.typeText(f.t.elem))
+			} else {
+				g.p("%s = *new(%s)", x, g.typeText(f.t))
+			}
+			g.p("} else {")
+			g.decode(f.t, x, "hdr", "item", fieldWrap(f.name))
+			g.p("}")
+		} else {
+			g.decode(f.t, x, "hdr", "item", fieldWrap(f.name))
+		}
+	}
+	g.p("default: // not one of ours, skip it")
+	g.p("if err := b3.GenCheckKey(hdr.Key); err != nil {")
+	g.p("return err")
+	g.p("}")
+	g.p("}")
+	g.p("}")
+	for i, r := range required {
+		g.p("if !seen[%d] {", i)
+		g.p("return b3.GenRequiredError(%q)", r.name)
+		g.p("}")
+	}
+	g.p("return nil")
+	g.p("}")
+	g.p("")
+}
+
+// Code to decode the item with header hdr and data item into x. wrap names where x is for its errors.
+func (g *generator) decode(t *goType, x string, hdr string, item string, wrap string) {
+	errReturn := func() {
+		g.p("if err != nil {")
+		g.p("return %s", wrapErr(wrap, "err"))
+		g.p("}")
+	}
+
+	switch t.kind {
+	case scalarKind:
+		builtin, _ := b3tag.Builtin(t.dt)
+		g.p("d, err := b3.GenDecode(%s, %s, b3.B3_%s, b3.%s)", hdr, item, t.dt, builtin.Decode)
+		errReturn()
+		switch t.class {
+		case "int":
+			g.p("n, err := b3.GenInt(d, %d)", t.bits)
+			errReturn()
+			g.p("%s = %s", x, convertTo(t, "int64", "n"))
+		case "uint":
+			g.p("n, err := b3.GenUint(d, %d)", t.bits)
+			errReturn()
+			g.p("%s = %s", x, convertTo(t, "uint64", "n"))
+		case "float":
+			g.p("f, err := b3.GenFloat(d, %d)", t.bits)
+			errReturn()
+			g.p("%s = %s", x, convertTo(t, "float64", "f"))
+		case "complex":
+			g.p("c, err := b3.GenComplex(d, %d)", t.bits)
+			errReturn()
+			g.p("%s = %s", x, convertTo(t, "complex128", "c"))
+		case "bool":
+			g.p("%s = %s", x, convertTo(t, "bool", "d.(bool)"))
+		case "string":
+			g.p("%s = %s", x, convertTo(t, "string", "d.(string)"))
+		case "bytes":
+			g.p("%s = %s", x, convertTo(t, "[]byte", "d.([]byte)"))
+		default: // time, decimal
+			g.p("%s = d.(%s)", x, g.typeText(t))
+		}
+
+	case marshalerKind:
+		g.p("if %s.IsNull {", hdr)
+		g.p("%s = *new(%s)", x, g.typeText(t))
+		g.p("} else if err := b3.GenUnmarshal(%s, %s, %s); err != nil {", addr(x), hdr, item)
+		g.p("return %s", wrapErr(wrap, "err"))
+		g.p("}")
+
+	case pointerKind:
+		g.p("if %s.IsNull {", hdr)
+		g.p("%s = nil", x)
+		g.p("} else {")
+		g.p("if %s == nil {", x)
+		g.p("%s = new(%s)", x, g.typeText(t.elem))
+		g.p("}")
+		g.decode(t.elem, "*"+x, hdr, item, wrap)
+		g.p("}")
+
+	case sliceKind:
+		n := g.next()
+		list, idx := fmt.Sprintf("list%d", n), fmt.Sprintf("index%d", n)
+		elemHdr, elemItem, elem := fmt.Sprintf("hdr%d", n), fmt.Sprintf("item%d", n), fmt.Sprintf("elem%d", n)
+		g.p("if err := b3.GenCheckType(%s.DataType, b3.B3_COMPOSITE_LIST); err != nil {", hdr)
+		g.p("return %s", wrapErr(wrap, "err"))
+		g.p("}")
+		g.p("if %s.IsNull {", hdr)
+		g.p("%s = nil", x)
+		g.p("} else {")
+		g.p("var %s %s", list, g.typeText(t))
+		g.p("for %s := 0; %s < len(%s); {", idx, idx, item)
+		g.p("%s, used, err := b3.DecodeHeader(%s[%s:])", elemHdr, item, idx)
+		errReturn()
+		g.p("%s += used", idx)
+		g.p("if err := b3.GenCheckListKey(%s.Key); err != nil {", elemHdr)
+		g.p("return %s", wrapErr(wrap, "err"))
+		g.p("}")
+		g.p("%s, err := b3.GenItemData(%s[%s:], %s)", elemItem, item, idx, elemHdr)
+		errReturn()
+		g.p("%s += %s.DataLen", idx, elemHdr)
+		g.p("var %s %s", elem, g.typeText(t.elem))
+		g.decode(t.elem, elem, elemHdr, elemItem, indexWrap(wrap, "len("+list+")"))
+		g.p("%s = append(%s, %s)", list, list, elem)
+		g.p("}")
+		g.p("%s = %s", x, list)
+		g.p("}")
+	}
+}
+
+// ===================== Expressions ===========================
+
+// Errors are wrapped on the way back up with the field they're about, and the list index if they're about an
+// element, so their paths are the same as the reflect path's. A wrap is the wrapping with %s for the error.
+func fieldWrap(field string) string {
+	return fmt.Sprintf("b3.GenFieldError(%%s, %q)", field)
+}
+
+// The wrap for an element of the list wrap is for, at index i (a go expression).
+func indexWrap(wrap string, i string) string {
+	return wrapErr(wrap, "b3.GenIndexError(%s, "+i+")")
+}
+
+// The error err (a go expression) wrapped.
+func wrapErr(wrap string, err string) string {
+	return strings.Replace(wrap, "%s", err, 1)
+}
+
+// x converted to the go type a codec wants, if it isn't that already.
+func convert(t *goType, to string, x string) string {
+	if t.text == to {
+		return x
+	}
+	return fmt.Sprintf("%s(%s)", to, x)
+}
+
+// A value of the codec's type converted back to the field's type.
+func convertTo(t *goType, from string, x string) string {
+	if t.text == from {
+		return x
+	}
+	return fmt.Sprintf("%s(%s)", t.text, x)
+}
+
+func addr(x string) string {
+	if strings.HasPrefix(x, "*") {
+		return x[1:]
+	}
+	return "&" + x
+}
+
+func index(x string, i string) string {
+	if strings.HasPrefix(x, "*") {
+		x = "(" + x + ")"
+	}
+	return x + "[" + i + "]"
+}
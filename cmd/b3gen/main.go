@@ -0,0 +1,56 @@
+// Command b3gen writes AppendB3/MarshalB3/UnmarshalB3 methods for b3 tagged structs, so they encode and decode
+// without reflection. Put a go:generate line next to the structs:
+//
+//	//go:generate go run github.com/oddy/b3-go/cmd/b3gen -type Order,Line
+//
+// and run go generate. The methods go in order_b3.go (order_b3_test.go if the structs are in a test file),
+// or -output. Their output is byte for byte what b3.StructToBuf makes, and b3.StructToBuf, b3.AppendStruct and
+// b3.BufToStruct use them automatically, as do structs with these ones inside them.
+//
+// The structs are tagged as for StructToBuf. Fields can be the plain go types (bools, numbers, strings,
+// []byte, time.Time, b3.Decimal), pointers to them, slices of them, and B3Marshaler/B3Unmarshaler types -
+// which includes the b3.Null* types and other structs b3gen has done. Nested structs need to be in the -type
+// list too. Maps, arrays and types that only have BinaryMarshaler/TextMarshaler aren't supported, use the
+// reflect path for those.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("b3gen: ")
+	typeNames := flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output := flag.String("output", "", "output file name; default <type>_b3.go in the package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: b3gen -type T[,T...] [-output file] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	src, name, err := generate(dir, strings.Split(*typeNames, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output != "" {
+		name = *output
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
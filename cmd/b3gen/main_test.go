@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The b3 package's tests check the generated code works, this checks it's up to date.
+func TestGenerateMatchesCheckedIn(t *testing.T) {
+	src, name, err := generate("../../b3", []string{"genOrder", "genLine"})
+	assert.Nil(t, err)
+	assert.Equal(t, "genorder_b3_test.go", name)
+	want, err := ioutil.ReadFile(filepath.Join("../../b3", name))
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), string(src), "run go generate in b3")
+}
+
+// Generate methods for a struct with every kind of field, then run them and the reflect path on the same values
+// and check the bytes (and what they decode to) are the same. Needs the go command, so not with -short.
+func TestGeneratedMatchesReflect(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if testing.Short() || err != nil {
+		t.Skip("needs the go command")
+	}
+	dir, err := ioutil.TempDir("testdata", "samebytes") // in the module, so it builds against this b3
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	src, err := ioutil.ReadFile("testdata/samebytes.go")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), src, 0644))
+
+	gen, name, err := generate(dir, []string{"everything", "inner"})
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), gen, 0644))
+
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	assert.Nil(t, err, string(out))
+	assert.Equal(t, "ok\n", string(out))
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "b3gen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	src := `package foo
+
+import "github.com/oddy/b3-go/b3"
+
+type Age uint8
+
+type ok struct {
+	A	Age	` + "`b3:\"1\"`" + `
+	B	*b3.NullString	` + "`b3:\"2\"`" + `
+}
+
+type notGenerated struct {
+	A	int	` + "`b3:\"1\"`" + `
+}
+
+type nested struct {
+	N	notGenerated	` + "`b3:\"1\"`" + `
+}
+
+type withMap struct {
+	M	map[string]int	` + "`b3:\"1\"`" + `
+}
+
+type withArray struct {
+	A	[4]int	` + "`b3:\"1\"`" + `
+}
+
+type badType struct {
+	A	string	` + "`b3:\"1,uvarint\"`" + `
+}
+
+type customType struct {
+	A	string	` + "`b3:\"1,money\"`" + `
+}
+
+type dupTag struct {
+	A	int	` + "`b3:\"1\"`" + `
+	B	int	` + "`b3:\"1\"`" + `
+}
+
+type unexported struct {
+	a	int	` + "`b3:\"1\"`" + `
+}
+
+type omitMarshaler struct {
+	N	b3.NullString	` + "`b3:\"1,,omitempty\"`" + `
+}
+
+type noFields struct {
+	A	int
+}
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte(src), 0644))
+
+	_, name, err := generate(dir, []string{"ok"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok_b3.go", name)
+
+	for typeName, msg := range map[string]string{
+		"nested":        "struct field nested.N: struct notGenerated has no MarshalB3, add it to -type",
+		"withMap":       "struct field withMap.M: type map[string]int not supported",
+		"withArray":     "struct field withArray.A: array [4]int not supported, use a slice",
+		"badType":       "struct field badType.A: b3.type UVARINT doesn't go with string",
+		"customType":    "struct field customType.A: b3gen only knows the built-in b3.types, not MONEY",
+		"dupTag":        "struct field dupTag.B: duplicate b3 tag 1, also on field A",
+		"unexported":    "struct field unexported.a: b3 tagged field is unexported",
+		"omitMarshaler": "struct field omitMarshaler.N: omitempty on a b3.NullString isn't supported, use a pointer",
+		"noFields":      "type noFields has no b3 fields",
+		"nope":          "type nope not found in " + dir,
+	} {
+		_, _, err := generate(dir, []string{typeName})
+		assert.EqualError(t, err, msg, typeName)
+	}
+
+	_, _, err = generate(dir, []string{"nested", "notGenerated"})
+	assert.Nil(t, err)
+}
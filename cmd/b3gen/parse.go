@@ -0,0 +1,341 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oddy/b3-go/internal/b3tag"
+	"github.com/pkg/errors"
+)
+
+const b3Path = "github.com/oddy/b3-go/b3"
+
+// The package being generated for, from its source. Only what's needed to work out field types - there's
+// no type checking, the go compiler does that on the generated code.
+type pkgInfo struct {
+	name      string
+	types     map[string]*typeDecl
+	methods   map[string]map[string]bool // receiver type name -> method names
+	generated map[string]bool            // the -type types
+}
+
+type typeDecl struct {
+	name    string
+	expr    ast.Expr
+	imports map[string]string // name -> import path, for the file it's in
+	test    bool              // in a _test.go file
+}
+
+type genStruct struct {
+	name   string
+	fields []genField // in item key order, see sortFields
+}
+
+type genField struct {
+	name string
+	b3tag.Field
+	t *goType
+}
+
+type kind int
+
+const (
+	scalarKind    kind = iota // a value that goes straight to a codec
+	marshalerKind             // has MarshalB3/UnmarshalB3
+	pointerKind
+	sliceKind
+)
+
+// goType is a field's type, as much as b3gen needs to know about it.
+type goType struct {
+	kind  kind
+	text  string   // go source for the type
+	quals []string // package names text uses
+	class string   // scalars: int, uint, float, complex, bool, string, bytes, time or decimal
+	bits  int      // int, uint, float and complex classes, 0 for int and uint
+	dt    string   // scalars: the b3 data type name. Marshalers: b3.type, if any
+	elem  *goType  // pointers and slices
+}
+
+type basicType struct {
+	class string
+	bits  int
+}
+
+var basicTypes = map[string]basicType{
+	"int": {"int", 0}, "int8": {"int", 8}, "int16": {"int", 16}, "int32": {"int", 32}, "int64": {"int", 64},
+	"rune": {"int", 32},
+	"uint": {"uint", 0}, "uint8": {"uint", 8}, "uint16": {"uint", 16}, "uint32": {"uint", 32}, "uint64": {"uint", 64},
+	"uintptr": {"uint", 0}, "byte": {"uint", 8},
+	"float32": {"float", 32}, "float64": {"float", 64},
+	"complex64": {"complex", 64}, "complex128": {"complex", 128},
+	"bool": {"bool", 0}, "string": {"string", 0},
+}
+
+func loadPackage(dir string, typeNames []string) (*pkgInfo, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	// dir can have a package and its _test package, use the one with the types in.
+	for _, pkg := range pkgs {
+		info := &pkgInfo{name: pkg.Name, types: map[string]*typeDecl{}, methods: map[string]map[string]bool{},
+			generated: map[string]bool{}}
+		for fileName, file := range pkg.Files {
+			info.addFile(fileName, file)
+		}
+		if _, ok := info.types[typeNames[0]]; ok {
+			for _, name := range typeNames {
+				info.generated[name] = true
+			}
+			return info, nil
+		}
+	}
+	return nil, errors.Errorf("type %s not found in %s", typeNames[0], dir)
+}
+
+func (p *pkgInfo) addFile(fileName string, file *ast.File) {
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					p.types[ts.Name.Name] = &typeDecl{name: ts.Name.Name, expr: ts.Type, imports: imports,
+						test: strings.HasSuffix(fileName, "_test.go")}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				continue
+			}
+			recv := d.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if ident, ok := recv.(*ast.Ident); ok {
+				if p.methods[ident.Name] == nil {
+					p.methods[ident.Name] = map[string]bool{}
+				}
+				p.methods[ident.Name][d.Name.Name] = true
+			}
+		}
+	}
+}
+
+func (p *pkgInfo) structFor(name string) (*genStruct, error) {
+	decl, ok := p.types[name]
+	if !ok {
+		return nil, errors.Errorf("type %s not found", name)
+	}
+	st, ok := decl.expr.(*ast.StructType)
+	if !ok {
+		return nil, errors.Errorf("type %s is not a struct", name)
+	}
+
+	s := &genStruct{name: name}
+	for _, f := range st.Fields.List {
+		names := make([]string, 0, len(f.Names))
+		for _, ident := range f.Names {
+			names = append(names, ident.Name)
+		}
+		if len(names) == 0 { // embedded, named after its type
+			names = append(names, embeddedName(f.Type))
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			unquoted, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(unquoted)
+		}
+		for _, fieldName := range names {
+			ft, isB3, err := b3tag.Parse(tag)
+			if err != nil {
+				return nil, fieldError(err, name, fieldName)
+			}
+			if !isB3 {
+				continue
+			}
+			if !ast.IsExported(fieldName) {
+				return nil, fieldError(errors.New("b3 tagged field is unexported"), name, fieldName)
+			}
+			if _, builtin := b3tag.Builtin(ft.TypeName); ft.TypeName != "" && ft.TypeName != "DICT" && ft.TypeName != "LIST" && !builtin {
+				return nil, fieldError(errors.Errorf("b3gen only knows the built-in b3.types, not %s", ft.TypeName), name, fieldName)
+			}
+			t, err := p.resolve(f.Type, ft.TypeName, decl.imports)
+			if err != nil {
+				return nil, fieldError(err, name, fieldName)
+			}
+			if ft.OmitEmpty && t.kind == marshalerKind {
+				return nil, fieldError(errors.Errorf("omitempty on a %s isn't supported, use a pointer", t.text), name, fieldName)
+			}
+			s.fields = append(s.fields, genField{name: fieldName, Field: ft, t: t})
+		}
+	}
+	if len(s.fields) == 0 {
+		return nil, errors.Errorf("type %s has no b3 fields", name)
+	}
+	if err := s.sortFields(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Fields in the order StructToBuf sends them - tag numbers, then the fields with only a key, by key.
+func (s *genStruct) sortFields() error {
+	sort.SliceStable(s.fields, func(i, j int) bool {
+		a, b := s.fields[i], s.fields[j]
+		if a.HasTag != b.HasTag {
+			return a.HasTag
+		}
+		if a.HasTag {
+			return a.Tag < b.Tag
+		}
+		return a.Key < b.Key
+	})
+	tags := map[int]string{}
+	keys := map[string]string{}
+	for _, f := range s.fields {
+		if other, dup := tags[f.Tag]; f.HasTag && dup {
+			return fieldError(errors.Errorf("duplicate b3 tag %d, also on field %s", f.Tag, other), s.name, f.name)
+		}
+		if other, dup := keys[f.Key]; f.Key != "" && dup {
+			return fieldError(errors.Errorf("duplicate b3 key %q, also on field %s", f.Key, other), s.name, f.name)
+		}
+		if f.HasTag {
+			tags[f.Tag] = f.name
+		}
+		if f.Key != "" {
+			keys[f.Key] = f.name
+		}
+	}
+	return nil
+}
+
+// Work out a field type. typeName is the b3.type, which for slices is the elements' type, like the reflect path.
+func (p *pkgInfo) resolve(expr ast.Expr, typeName string, imports map[string]string) (*goType, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if basic, ok := basicTypes[e.Name]; ok {
+			return scalarType(e.Name, nil, basic.class, basic.bits, typeName)
+		}
+		decl, ok := p.types[e.Name]
+		if !ok {
+			return nil, errors.Errorf("type %s not found", e.Name)
+		}
+		methods := p.methods[e.Name]
+		if p.generated[e.Name] || (methods["MarshalB3"] && methods["UnmarshalB3"]) {
+			return &goType{kind: marshalerKind, text: e.Name, dt: typeName}, nil
+		}
+		for _, m := range []string{"MarshalB3", "UnmarshalB3", "MarshalBinary", "UnmarshalBinary", "MarshalText", "UnmarshalText"} {
+			if methods[m] {
+				return nil, errors.Errorf("type %s has %s, b3gen needs both MarshalB3 and UnmarshalB3", e.Name, m)
+			}
+		}
+		if _, isStruct := decl.expr.(*ast.StructType); isStruct {
+			return nil, errors.Errorf("struct %s has no MarshalB3, add it to -type", e.Name)
+		}
+		// a named basic type or slice, e.g. type Age uint8
+		t, err := p.resolve(decl.expr, typeName, decl.imports)
+		if err != nil {
+			return nil, errors.Wrapf(err, "type %s", e.Name)
+		}
+		if t.kind == pointerKind {
+			return nil, errors.Errorf("named pointer type %s not supported", e.Name)
+		}
+		t.text = e.Name
+		return t, nil
+
+	case *ast.SelectorExpr:
+		pkgIdent, ok := e.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		importPath := imports[pkgIdent.Name]
+		quals := []string{pkgIdent.Name}
+		text := types.ExprString(e)
+		switch {
+		case importPath == "time" && e.Sel.Name == "Time":
+			return scalarType(text, quals, "time", 0, typeName)
+		case importPath == b3Path && e.Sel.Name == "Decimal":
+			return scalarType(text, quals, "decimal", 0, typeName)
+		}
+		// Anything else from another package has to be a B3Marshaler, if it isn't it won't compile.
+		return &goType{kind: marshalerKind, text: text, quals: quals, dt: typeName}, nil
+
+	case *ast.StarExpr:
+		elem, err := p.resolve(e.X, typeName, imports)
+		if err != nil {
+			return nil, err
+		}
+		if elem.kind == pointerKind {
+			return nil, errors.New("pointers to pointers not supported")
+		}
+		return &goType{kind: pointerKind, text: "*" + elem.text, quals: elem.quals, elem: elem}, nil
+
+	case *ast.ArrayType:
+		if e.Len != nil {
+			return nil, errors.Errorf("array %s not supported, use a slice", types.ExprString(e))
+		}
+		if ident, ok := e.Elt.(*ast.Ident); ok && (ident.Name == "byte" || ident.Name == "uint8") &&
+			(typeName == "" || typeName == "BYTES") {
+			return scalarType(types.ExprString(e), nil, "bytes", 0, typeName)
+		}
+		elemTypeName := typeName
+		if typeName == "LIST" {
+			elemTypeName = ""
+		}
+		elem, err := p.resolve(e.Elt, elemTypeName, imports)
+		if err != nil {
+			return nil, err
+		}
+		return &goType{kind: sliceKind, text: "[]" + elem.text, quals: elem.quals, elem: elem}, nil
+	}
+	return nil, errors.Errorf("type %s not supported", types.ExprString(expr))
+}
+
+func scalarType(text string, quals []string, class string, bits int, typeName string) (*goType, error) {
+	allowed := b3tag.ClassDataTypes[class]
+	dt := allowed[0]
+	if typeName != "" {
+		dt = ""
+		for _, name := range allowed {
+			if name == typeName {
+				dt = name
+			}
+		}
+		if dt == "" {
+			return nil, errors.Errorf("b3.type %s doesn't go with %s", typeName, text)
+		}
+	}
+	return &goType{kind: scalarKind, text: text, quals: quals, class: class, bits: bits, dt: dt}, nil
+}
+
+func embeddedName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	return types.ExprString(expr)
+}
+
+func fieldError(err error, structName string, fieldName string) error {
+	return errors.Wrapf(err, "struct field %s.%s", structName, fieldName)
+}
@@ -0,0 +1,97 @@
+// Run by TestGeneratedMatchesReflect, with everything_b3.go generated next to it. Prints "ok" if the generated
+// methods and the reflect path make and read the same bytes.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/oddy/b3-go/b3"
+)
+
+// A field for each class of go value and each b3.type it can be, in both tag styles.
+type everything struct {
+	I   int          `b3:"1"`
+	I8  int8         `b3:"2,uvarint"`
+	I64 int64        `b3.tag:"3" b3.type:"INT64"`
+	U   uint         `b3:"4"`
+	U16 uint16       `b3:"5,svarint"`
+	U32 uint32       `b3:"6,int64"`
+	F32 float32      `b3:"7"`
+	F   float64      `b3:"8,float64"`
+	C   complex128   `b3:"9"`
+	B   bool         `b3:"10"`
+	S   string       `b3:"11,,key=s"`
+	Bs  []byte       `b3:"12"`
+	T   time.Time    `b3:"13"`
+	TS  time.Time    `b3:"14,sched"`
+	D   b3.Decimal   `b3:"15"`
+	P   *int         `b3:"16"`
+	PZ  *string      `b3:"17,,nullzero"`
+	L   []int16      `b3:"18,uvarint"`
+	LL  [][]string   `b3:"19"`
+	In  inner        `b3:"20"`
+	PIn *inner       `b3:"21"`
+	Ins []inner      `b3:"22"`
+	N   b3.NullInt64 `b3:"23"`
+	O   string       `b3:"24,,omitempty"`
+	K   int          `b3.key:"k" b3.type:"SVARINT"`
+}
+
+type inner struct {
+	X int    `b3:"1,,required"`
+	Y string `b3:",,key=y"`
+}
+
+// Same fields, no methods, so these go the reflect way.
+type plainEverything everything
+type plainInner inner
+
+type marshaler interface {
+	MarshalB3() (int, []byte, error)
+}
+
+var failed = false
+
+func check(name string, gen marshaler, plain interface{}, genDst interface{}, plainDst interface{}) {
+	_, genBuf, genErr := gen.MarshalB3()
+	plainBuf, plainErr := b3.StructToBuf(plain)
+	if genErr != nil || plainErr != nil || !bytes.Equal(genBuf, plainBuf) {
+		fmt.Printf("%s: generated % x (%v), reflect % x (%v)\n", name, genBuf, genErr, plainBuf, plainErr)
+		failed = true
+		return
+	}
+	genErr = genDst.(interface {
+		UnmarshalB3(int, []byte) error
+	}).UnmarshalB3(b3.B3_COMPOSITE_DICT, plainBuf)
+	plainErr = b3.BufToStruct(plainBuf, len(plainBuf), plainDst)
+	got := reflect.ValueOf(genDst).Elem().Convert(reflect.TypeOf(plainDst).Elem()).Interface()
+	if genErr != nil || plainErr != nil || !reflect.DeepEqual(got, reflect.ValueOf(plainDst).Elem().Interface()) {
+		fmt.Printf("%s: generated decode %+v (%v), reflect %+v (%v)\n", name, got, genErr, plainDst, plainErr)
+		failed = true
+	}
+}
+
+func main() {
+	n, s := -7, "z"
+	full := everything{
+		I: -1, I8: 100, I64: -1 << 40, U: 1 << 40, U16: 65535, U32: 7, F32: 1.5, F: -2.25, C: complex(1, -1),
+		B: true, S: "str", Bs: []byte{1, 2, 3}, T: time.Unix(1600000000, 5).UTC(),
+		TS: time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("", 3600)), D: b3.NewDecimal(big.NewInt(-1999), -2),
+		P: &n, PZ: &s, L: []int16{0, 300}, LL: [][]string{{"a"}, {}, {"b", ""}}, In: inner{X: 1, Y: "y"},
+		PIn: &inner{X: 2}, Ins: []inner{{X: 3}, {Y: "w"}}, N: b3.NullInt64{Int64: 9, Valid: true}, O: "o", K: -3,
+	}
+	withZeros := everything{In: inner{X: 1}, Ins: []inner{{X: 1}}}
+
+	check("full", full, plainEverything(full), &everything{}, &plainEverything{})
+	check("zeros", withZeros, plainEverything(withZeros), &everything{}, &plainEverything{})
+	check("inner", full.In, plainInner(full.In), &inner{}, &plainInner{})
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+}
@@ -1,6 +1,6 @@
 module github.com/oddy/b3-go
 
-go 1.13
+go 1.15
 
 require (
 	github.com/pkg/errors v0.9.1
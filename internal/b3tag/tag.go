@@ -0,0 +1,82 @@
+// Package b3tag is the b3 struct tag parser and the table of built-in data types. The b3 package's reflection
+// and cmd/b3gen's generated code both work from these, so the bytes they make can't drift apart.
+package b3tag
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The tag formats are described for users in the b3 package, in struct_tags.go.
+
+// A Field is what a struct field's b3 tags say about it.
+type Field struct {
+	HasTag    bool
+	Tag       int
+	Key       string
+	TypeName  string
+	OmitEmpty bool
+	Required  bool
+	NullZero  bool
+}
+
+// Parse parses a struct field's tags. It returns ok false for fields that aren't b3 fields.
+func Parse(tag reflect.StructTag) (ft Field, ok bool, err error) {
+	compact, hasCompact := tag.Lookup("b3")
+	tagStr := tag.Get("b3.tag")
+	typeName := tag.Get("b3.type")
+	key := tag.Get("b3.key")
+
+	if hasCompact {
+		if tagStr != "" || typeName != "" || key != "" {
+			return ft, false, errors.New("use either the b3 tag or b3.tag/b3.type/b3.key, not both")
+		}
+		if compact == "-" {
+			return ft, false, nil
+		}
+		parts := strings.Split(compact, ",")
+		tagStr = strings.TrimSpace(parts[0])
+		for i, part := range parts[1:] {
+			part = strings.TrimSpace(part)
+			switch {
+			case strings.HasPrefix(part, "key="):
+				key = strings.TrimPrefix(part, "key=")
+				if key == "" {
+					return ft, false, errors.Errorf("b3 tag %q has an empty key=", compact)
+				}
+			case part == "omitempty":
+				ft.OmitEmpty = true
+			case part == "required":
+				ft.Required = true
+			case part == "nullzero":
+				ft.NullZero = true
+			case i == 0:
+				typeName = strings.ToUpper(part) // may be empty, e.g. b3:"3,,omitempty"
+			default:
+				return ft, false, errors.Errorf("b3 tag %q has unknown option %q", compact, part)
+			}
+		}
+		if tagStr == "" && key == "" {
+			return ft, false, errors.Errorf("b3 tag %q needs a tag number or a key=", compact)
+		}
+	} else if tagStr == "" && key == "" {
+		return ft, false, nil // no b3.tag or b3.key struct tag, skip struct field.
+	}
+
+	if tagStr != "" {
+		n, err := strconv.Atoi(tagStr)
+		if err != nil {
+			return ft, false, errors.Wrap(err, "struct b3.tag is not a number")
+		}
+		if n < 0 {
+			return ft, false, errors.Errorf("struct b3.tag %d is negative", n)
+		}
+		ft.HasTag, ft.Tag = true, n
+	}
+	ft.Key = key
+	ft.TypeName = typeName
+	return ft, true, nil
+}
@@ -0,0 +1,79 @@
+package b3tag
+
+import "reflect"
+
+// A DataType is one of the built-in data types, with the names of its codec funcs in the b3 package (for code
+// generation - the b3 package checks they're the funcs it registers).
+type DataType struct {
+	Number int
+	Name   string
+	Encode string
+	Decode string
+}
+
+// Builtins are the built-in data types, in number order. Data type numbers are the same as the python
+// reference implementation's. 1 and 2 are DICT and LIST, which aren't codecs.
+var Builtins = []DataType{
+	{3, "BYTES", "EncodeBytes", "DecodeBytes"},
+	{4, "UTF8", "EncodeUtf8", "DecodeUtf8"},
+	{5, "BOOL", "EncodeBool", "DecodeBool"},
+	{6, "INT64", "EncodeInt64", "DecodeInt64"},
+	{7, "UVARINT", "CodecEncodeUvarint", "CodecDecodeUvarint"},
+	{8, "SVARINT", "CodecEncodeSvarint", "CodecDecodeSvarint"},
+	{9, "FLOAT64", "EncodeFloat64", "DecodeFloat64"},
+	{10, "DECIMAL", "EncodeDecimal", "DecodeDecimal"},
+	{11, "SCHED", "EncodeSched", "DecodeSched"},
+	{12, "STAMP64", "EncodeStamp64", "DecodeStamp64"},
+	{13, "COMPLEX", "EncodeComplex", "DecodeComplex"},
+}
+
+// Builtin finds a built-in data type by name.
+func Builtin(name string) (DataType, bool) {
+	for _, dt := range Builtins {
+		if dt.Name == name {
+			return dt, true
+		}
+	}
+	return DataType{}, false
+}
+
+// Go values are grouped into classes for picking their data type: int, uint, float, complex, bool, string,
+// bytes, time (time.Time), decimal (b3.Decimal) and bigint (*big.Int).
+
+// ClassDataTypes are the data types each class of go value can be, the default (for no b3.type) first.
+var ClassDataTypes = map[string][]string{
+	"int":     {"SVARINT", "UVARINT", "INT64"},
+	"uint":    {"UVARINT", "SVARINT", "INT64"},
+	"float":   {"FLOAT64"},
+	"complex": {"COMPLEX"},
+	"bool":    {"BOOL"},
+	"string":  {"UTF8"},
+	"bytes":   {"BYTES"},
+	"time":    {"STAMP64", "SCHED"},
+	"decimal": {"DECIMAL"},
+	"bigint":  {"UVARINT", "SVARINT"},
+}
+
+// KindClass is the class of a go type from its kind, "" if its kind doesn't say (time, decimal and bigint are
+// structs or pointers to them, and are known by their type instead).
+func KindClass(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Complex64, reflect.Complex128:
+		return "complex"
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+	}
+	return ""
+}